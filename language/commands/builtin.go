@@ -0,0 +1,256 @@
+package commands
+
+var directions = []string{"h", "v"}
+
+var flipModes = []string{"h", "v", "both", "mirror"}
+
+var scaleModes = []string{"stretch", "fit", "fill"}
+
+var sortOrders = []string{"name", "mtime", "created"}
+
+var builtin = []Signature{
+	{
+		Name:        "open",
+		Description: "Open a media file, every media file in a directory, or the files matching a pattern such as clips/**/*.mov.",
+		Params: []Param{
+			{Name: "path", Type: TypeString, Description: "file, directory or pattern to open, ** matches any number of directories"},
+			{Name: "ext", Type: TypeString, Default: "", Description: "extensions or groups (video, audio, image) to pick up, comma separated, video and audio by default"},
+			{Name: "sort", Type: TypeString, Default: "name", Enum: sortOrders, Description: "order of the files: name in natural order, mtime, or the created date stored in the file"},
+			{Name: "fps", Type: TypeNumber, Default: 0.0, Description: "frame rate of an image sequence, such as frames/%04d.png or stills/*.jpg, the canvas frame rate by default"},
+		},
+	},
+	{
+		Name:        "export",
+		Description: "Encode a stream into a file. Stream lists get an index appended to the file name.",
+		Params: []Param{
+			{Name: "stream", Type: TypeStream, Description: "stream to export"},
+			{Name: "path", Type: TypeString, Description: "output file"},
+			{Name: "preset", Type: TypeString, Default: "", Description: "named settings such as web, archive, prores, social-vertical or gif, or one from the config, the other arguments win over it"},
+			{Name: "width", Type: TypeNumber, Default: 0.0, Description: "frame width, the canvas width by default"},
+			{Name: "height", Type: TypeNumber, Default: 0.0, Description: "frame height, the canvas height by default"},
+			{Name: "fps", Type: TypeNumber, Default: 0.0, Description: "frame rate, the canvas frame rate by default"},
+			{Name: "pixfmt", Type: TypeString, Default: "", Description: "pixel format, the canvas pixel format by default"},
+			{Name: "samplerate", Type: TypeNumber, Default: 0.0, Description: "audio sample rate, the canvas sample rate by default"},
+			{Name: "vcodec", Type: TypeString, Default: "", Enum: encoderNames(false), Description: "video encoder, libx264 by default (libvpx-vp9 for webm)"},
+			{Name: "acodec", Type: TypeString, Default: "", Enum: encoderNames(true), Description: "audio encoder, aac by default (libopus for webm)"},
+			{Name: "crf", Type: TypeNumber, Default: -1.0, Description: "constant quality, lower is better, the range depends on the encoder"},
+			{Name: "bitrate", Type: TypeString, Default: "", Description: "video bitrate such as 5M or 800k, instead of crf"},
+			{Name: "abitrate", Type: TypeString, Default: "", Description: "audio bitrate such as 192k"},
+			{Name: "speed", Type: TypeString, Default: "", Description: "encoder speed preset such as slow or veryfast"},
+			{Name: "profile", Type: TypeString, Default: "", Description: "encoder profile such as high or main10"},
+			{Name: "format", Type: TypeString, Default: "", Enum: containerNames(), Description: "container format, taken from the file extension by default"},
+			{Name: "size", Type: TypeString, Default: "", Description: "target file size such as 8MB, encoded with libx264 in two passes to fit it"},
+			{Name: "dither", Type: TypeString, Default: "", Enum: Dithers, Description: "dither mode of gif palettes, sierra2_4a by default"},
+			{Name: "loop", Type: TypeNumber, Default: 0.0, Description: "times a gif or webp plays again, 0 loops forever and -1 plays once"},
+			{Name: "faststart", Type: TypeBool, Default: false, Description: "move the index to the front of mp4 and mov files for web playback"},
+		},
+	},
+	{
+		Name:        "snapshot",
+		Description: "Write the frame at a time of a stream to an image, without encoding the rest of it.",
+		Params: []Param{
+			{Name: "stream", Type: TypeStream, Description: "stream to take the frame from"},
+			{Name: "time", Type: TypeNumber, Description: "time of the frame in seconds"},
+			{Name: "path", Type: TypeString, Description: "output image, png, jpg, tif or bmp"},
+		},
+	},
+	{
+		Name:        "contactsheet",
+		Description: "Write evenly spaced frames of a stream to one image, as a grid.",
+		Params: []Param{
+			{Name: "stream", Type: TypeStream, Description: "stream to sample"},
+			{Name: "cols", Type: TypeNumber, Description: "frames per row"},
+			{Name: "rows", Type: TypeNumber, Description: "number of rows"},
+			{Name: "path", Type: TypeString, Description: "output image, png, jpg, tif or bmp"},
+			{Name: "width", Type: TypeNumber, Default: 0.0, Description: "width of the sheet, the canvas width by default"},
+		},
+	},
+	{
+		Name:        "canvas",
+		Description: "Set the resolution, frame rate, pixel format and sample rate clips are normalized to and exported in, for the rest of the script.",
+		Directive:   true,
+		Params: []Param{
+			{Name: "width", Type: TypeNumber, Description: "frame width in pixels"},
+			{Name: "height", Type: TypeNumber, Description: "frame height in pixels"},
+			{Name: "fps", Type: TypeNumber, Default: 0.0, Description: "frame rate, unchanged when omitted"},
+			{Name: "pixfmt", Type: TypeString, Default: "", Description: "pixel format such as yuv420p, unchanged when omitted"},
+			{Name: "samplerate", Type: TypeNumber, Default: 0.0, Description: "audio sample rate, unchanged when omitted"},
+		},
+	},
+	{
+		Name:        "cut",
+		Description: "Keep only the part of the stream between two timestamps.",
+		Input:       true,
+		Params: []Param{
+			{Name: "start", Type: TypeNumber, Description: "start time in seconds"},
+			{Name: "end", Type: TypeNumber, Description: "end time in seconds"},
+		},
+	},
+	{
+		Name:        "concat",
+		Description: "Play streams one after another, normalized to the canvas.",
+		Params: []Param{
+			{Name: "streams", Type: TypeStream, Variadic: true, Description: "streams to join, in order"},
+		},
+	},
+	{
+		Name:        "brightness",
+		Description: "Adjust the brightness.",
+		Input:       true,
+		Params: []Param{
+			{Name: "value", Type: TypeNumber, Description: "-1.0 to 1.0, 0 keeps the original"},
+		},
+	},
+	{
+		Name:        "contrast",
+		Description: "Adjust the contrast.",
+		Input:       true,
+		Params: []Param{
+			{Name: "value", Type: TypeNumber, Description: "-1000.0 to 1000.0, 1 keeps the original"},
+		},
+	},
+	{
+		Name:        "saturation",
+		Description: "Adjust the saturation.",
+		Input:       true,
+		Params: []Param{
+			{Name: "value", Type: TypeNumber, Description: "0.0 to 3.0, 1 keeps the original"},
+		},
+	},
+	{
+		Name:        "gamma",
+		Description: "Adjust the gamma.",
+		Input:       true,
+		Params: []Param{
+			{Name: "value", Type: TypeNumber, Description: "0.1 to 10.0, 1 keeps the original"},
+		},
+	},
+	{
+		Name:        "hue",
+		Description: "Rotate the hue.",
+		Input:       true,
+		Params: []Param{
+			{Name: "degrees", Type: TypeNumber, Description: "hue angle in degrees"},
+		},
+	},
+	{
+		Name:        "flip",
+		Description: "Mirror the stream.",
+		Input:       true,
+		Params: []Param{
+			{Name: "direction", Type: TypeString, Enum: flipModes, Description: "h flips left to right, v upside down, both does both, and mirror puts the frame next to its reflection"},
+		},
+	},
+	{
+		Name:        "crop",
+		Description: "Keep a rectangle of the frame.",
+		Input:       true,
+		Params: []Param{
+			{Name: "width", Type: TypeNumber, Description: "width of the rectangle"},
+			{Name: "height", Type: TypeNumber, Description: "height of the rectangle"},
+			{Name: "x", Type: TypeNumber, Default: -1.0, Description: "left edge, centered by default"},
+			{Name: "y", Type: TypeNumber, Default: -1.0, Description: "top edge, centered by default"},
+		},
+	},
+	{
+		Name:        "scale",
+		Description: "Resize the frame.",
+		Input:       true,
+		Params: []Param{
+			{Name: "width", Type: TypeNumber, Description: "new width, -1 to follow the aspect ratio"},
+			{Name: "height", Type: TypeNumber, Description: "new height, -1 to follow the aspect ratio"},
+			{Name: "mode", Type: TypeString, Default: "stretch", Enum: scaleModes, Description: "stretch to the size, fit inside it or fill it and crop the rest"},
+		},
+	},
+	{
+		Name:        "pad",
+		Description: "Center the frame on a larger one.",
+		Input:       true,
+		Params: []Param{
+			{Name: "width", Type: TypeNumber, Description: "width of the padded frame"},
+			{Name: "height", Type: TypeNumber, Description: "height of the padded frame"},
+			{Name: "color", Type: TypeString, Default: "black", Description: "color of the border, a name or #rrggbb"},
+		},
+	},
+	{
+		Name:        "rotate",
+		Description: "Turn the frame clockwise, other angles than quarter turns enlarge the frame to fit.",
+		Input:       true,
+		Params: []Param{
+			{Name: "degrees", Type: TypeNumber, Description: "angle, negative turns counterclockwise"},
+		},
+	},
+	{
+		Name:        "text",
+		Description: "Draw text over the frame, for the whole clip or between two times.",
+		Input:       true,
+		Params: []Param{
+			{Name: "text", Type: TypeString, Description: "text to draw, shown as is"},
+			{Name: "x", Type: TypeAny, Default: "center", Keywords: []string{"left", "center", "right"}, Description: "left edge in pixels, or left, center or right"},
+			{Name: "y", Type: TypeAny, Default: "center", Keywords: []string{"top", "center", "bottom"}, Description: "top edge in pixels, or top, center or bottom"},
+			{Name: "size", Type: TypeNumber, Default: 48.0, Description: "font size in pixels"},
+			{Name: "color", Type: TypeString, Default: "white", Description: "text color, a name or #rrggbb, @0.5 for transparency"},
+			{Name: "font", Type: TypeString, Default: "", Description: "font file, relative to the script, the system font by default"},
+			{Name: "from", Type: TypeNumber, Default: -1.0, Description: "time the text appears, from the start by default"},
+			{Name: "to", Type: TypeNumber, Default: -1.0, Description: "time the text disappears, at the end by default"},
+			{Name: "box", Type: TypeBool, Default: false, Description: "draw a box behind the text"},
+			{Name: "boxcolor", Type: TypeString, Default: "black@0.5", Description: "color of the box"},
+		},
+	},
+	{
+		Name:        "extractaudio",
+		Description: "Keep only the audio of a clip, straight from open, e.g. to export it as mp3 or wav.",
+		Input:       true,
+	},
+	{
+		Name:        "stack",
+		Description: "Place the input and other streams side by side (h) or on top of each other (v).",
+		Input:       true,
+		Params: []Param{
+			{Name: "direction", Type: TypeString, Enum: directions, Description: "h or v"},
+			{Name: "streams", Type: TypeStream, Variadic: true, Description: "streams stacked after the input"},
+		},
+	},
+}
+
+var builtinFunctions = []Function{
+	{
+		Signature: Signature{
+			Name:        "env",
+			Description: "Value of an environment variable, empty when it is not set.",
+			Params: []Param{
+				{Name: "name", Type: TypeString, Description: "variable name"},
+			},
+		},
+		Result: TypeString,
+	},
+	clipFunction("duration", "Length of a clip in seconds.", TypeNumber),
+	clipFunction("width", "Frame width of a clip in pixels.", TypeNumber),
+	clipFunction("height", "Frame height of a clip in pixels.", TypeNumber),
+	clipFunction("fps", "Frame rate of a clip.", TypeNumber),
+	clipFunction("hasaudio", "Whether a clip has an audio track, edited clips have none.", TypeBool),
+}
+
+// clipFunction describes a function reading the probed media info of a
+// single clip
+func clipFunction(name, description string, result Type) Function {
+	return Function{
+		Signature: Signature{
+			Name:        name,
+			Description: description,
+			Params: []Param{
+				{Name: "clip", Type: TypeStream, Description: "a single clip"},
+			},
+		},
+		Result: result,
+	}
+}
+
+func init() {
+	for _, sig := range builtin {
+		Register(sig)
+	}
+	for _, fn := range builtinFunctions {
+		RegisterFunction(fn)
+	}
+}
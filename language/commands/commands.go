@@ -0,0 +1,284 @@
+// Package commands holds the signatures of every vidlang command.
+//
+// The signatures are shared by the lexer, which takes its command keywords
+// from them, the static checker and the interpreter, which validate and bind
+// arguments with them, and the help listing.
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Type is the kind of value a parameter accepts
+type Type int
+
+const (
+	TypeAny Type = iota
+	TypeBool
+	TypeNumber
+	TypeString
+	TypeStream
+	TypeList
+)
+
+func (t Type) String() string {
+	switch t {
+	case TypeBool:
+		return "bool"
+	case TypeNumber:
+		return "number"
+	case TypeString:
+		return "string"
+	case TypeStream:
+		return "stream"
+	case TypeList:
+		return "list"
+	}
+	return "any"
+}
+
+// Param describes a single command parameter
+type Param struct {
+	Name        string
+	Type        Type
+	Default     any      // value used when the argument is omitted, nil if required
+	Enum        []string // allowed values of a string parameter
+	Variadic    bool     // collects every remaining argument, only valid last, at least one unless it has a default
+	Keywords    []string // bare words taken as strings rather than variables, as in x=center
+	Description string
+}
+
+// IsKeyword reports whether a bare word given for the parameter is one of
+// its keywords
+func (p Param) IsKeyword(word string) bool {
+	for _, k := range p.Keywords {
+		if k == word {
+			return true
+		}
+	}
+	return false
+}
+
+// Required reports whether the argument has to be given
+func (p Param) Required() bool {
+	return p.Default == nil
+}
+
+func (p Param) String() string {
+	typ := p.Type.String()
+	if len(p.Enum) > 0 {
+		quoted := make([]string, 0, len(p.Enum))
+		for _, e := range p.Enum {
+			quoted = append(quoted, fmt.Sprintf("%q", e))
+		}
+		typ = strings.Join(quoted, "|")
+	}
+	s := p.Name + ":" + typ
+	if p.Variadic {
+		s += "..."
+	}
+	if !p.Required() {
+		s = "[" + s + "]"
+	}
+	return s
+}
+
+// Signature describes a command: its parameters, whether it consumes the
+// stream piped into it, and what it does
+type Signature struct {
+	Name        string
+	Params      []Param
+	Input       bool // the command transforms the stream piped into it
+	Directive   bool // the command sets up the project, it is a statement of its own and gives no stream
+	Description string
+}
+
+// Usage returns a one line synopsis such as `cut start:number end:number`
+func (s Signature) Usage() string {
+	parts := []string{s.Name}
+	for _, p := range s.Params {
+		parts = append(parts, p.String())
+	}
+	return strings.Join(parts, " ")
+}
+
+// maxListedOptions is the number of optional parameters Synopsis still
+// spells out
+const maxListedOptions = 5
+
+// Synopsis is Usage for listings and error messages, commands with many
+// optional parameters show them as [options...]
+func (s Signature) Synopsis() string {
+	optional := 0
+	for _, p := range s.Params {
+		if !p.Required() {
+			optional++
+		}
+	}
+	if optional <= maxListedOptions {
+		return s.Usage()
+	}
+	parts := []string{s.Name}
+	for _, p := range s.Params {
+		if p.Required() {
+			parts = append(parts, p.String())
+		}
+	}
+	return strings.Join(append(parts, "[options...]"), " ")
+}
+
+// Param looks up a parameter by name
+func (s Signature) Param(name string) (Param, bool) {
+	for _, p := range s.Params {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Param{}, false
+}
+
+var registry = make(map[string]Signature)
+
+// Register adds a command signature, it panics on duplicates and on
+// malformed parameter lists
+func Register(sig Signature) {
+	if _, ok := registry[sig.Name]; ok {
+		panic(fmt.Sprintf("commands: %s registered twice", sig.Name))
+	}
+	optional := false
+	for i, p := range sig.Params {
+		if p.Variadic && i != len(sig.Params)-1 {
+			panic(fmt.Sprintf("commands: %s: variadic parameter %s must be last", sig.Name, p.Name))
+		}
+		if p.Required() && optional {
+			panic(fmt.Sprintf("commands: %s: required parameter %s follows an optional one", sig.Name, p.Name))
+		}
+		optional = optional || !p.Required()
+	}
+	registry[sig.Name] = sig
+}
+
+// Lookup returns the signature of a command
+func Lookup(name string) (Signature, bool) {
+	sig, ok := registry[name]
+	return sig, ok
+}
+
+// IsCommand reports whether name is a registered command
+func IsCommand(name string) bool {
+	_, ok := registry[name]
+	return ok
+}
+
+// All returns every registered signature sorted by name
+func All() []Signature {
+	sigs := make([]Signature, 0, len(registry))
+	for _, sig := range registry {
+		sigs = append(sigs, sig)
+	}
+	sort.Slice(sigs, func(i, j int) bool { return sigs[i].Name < sigs[j].Name })
+	return sigs
+}
+
+// Assign decides which parameter every argument of a call binds to.
+// names holds one entry per argument in source order, the parameter name
+// for `name=value` arguments and "" for positional ones. Positional
+// arguments fill, in order, the parameters not given by name, a variadic
+// parameter takes all that remain.
+//
+// The result holds, for each parameter, the indexes of its arguments.
+func (s Signature) Assign(names []string) ([][]int, error) {
+	slots := make([][]int, len(s.Params))
+	named := make([]bool, len(s.Params))
+
+	for i, name := range names {
+		if name == "" {
+			continue
+		}
+		idx := s.paramIndex(name)
+		if idx < 0 {
+			return nil, fmt.Errorf("command %s has no parameter %s (usage: %s)", s.Name, name, s.Synopsis())
+		}
+		if named[idx] {
+			return nil, fmt.Errorf("command %s: argument %s given twice", s.Name, name)
+		}
+		named[idx] = true
+		slots[idx] = append(slots[idx], i)
+	}
+
+	next, positional := 0, 0
+	for i, name := range names {
+		if name != "" {
+			continue
+		}
+		positional++
+		for next < len(s.Params) && named[next] {
+			next++
+		}
+		if next >= len(s.Params) {
+			return nil, fmt.Errorf("command %s takes at most %d positional argument(s), got %d (usage: %s)",
+				s.Name, s.maxPositional(named), countPositional(names), s.Synopsis())
+		}
+		slots[next] = append(slots[next], i)
+		if !s.Params[next].Variadic {
+			next++
+		}
+	}
+
+	for i, p := range s.Params {
+		if p.Required() && len(slots[i]) == 0 {
+			return nil, fmt.Errorf("command %s: missing argument %s (usage: %s)", s.Name, p.Name, s.Synopsis())
+		}
+	}
+
+	return slots, nil
+}
+
+func (s Signature) paramIndex(name string) int {
+	for i, p := range s.Params {
+		if p.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s Signature) maxPositional(named []bool) int {
+	n := 0
+	for i := range s.Params {
+		if !named[i] {
+			n++
+		}
+	}
+	return n
+}
+
+func countPositional(names []string) int {
+	n := 0
+	for _, name := range names {
+		if name == "" {
+			n++
+		}
+	}
+	return n
+}
+
+// CheckEnum returns an error when the parameter restricts its values and
+// v is not one of them
+func (p Param) CheckEnum(v string) error {
+	if len(p.Enum) == 0 {
+		return nil
+	}
+	for _, e := range p.Enum {
+		if e == v {
+			return nil
+		}
+	}
+	quoted := make([]string, 0, len(p.Enum))
+	for _, e := range p.Enum {
+		quoted = append(quoted, fmt.Sprintf("%q", e))
+	}
+	return fmt.Errorf("must be one of %s, got %q", strings.Join(quoted, ", "), v)
+}
@@ -0,0 +1,150 @@
+package commands
+
+import "sort"
+
+// Encoder describes an encoder export can use and the settings it takes
+type Encoder struct {
+	Name     string
+	Audio    bool       // an audio encoder, else a video one
+	CRF      [2]float64 // accepted crf range, both zero when crf is not supported
+	Speeds   []string   // accepted speed presets, nil when not supported
+	Profiles []string   // accepted profiles, nil when not supported
+	PixFmts  []string   // pixel formats it needs, nil when it takes the usual ones
+	Formats  []string   // containers it can be written to
+}
+
+// Dithers are the dither modes of gif palettes
+var Dithers = []string{"none", "bayer", "heckbert", "floyd_steinberg", "sierra2", "sierra2_4a"}
+
+var x26xSpeeds = []string{"ultrafast", "superfast", "veryfast", "faster", "fast", "medium", "slow", "slower", "veryslow", "placebo"}
+
+// Encoders is the table export settings are validated against, by name
+var Encoders = map[string]Encoder{
+	"libx264": {
+		Name: "libx264", CRF: [2]float64{0, 51}, Speeds: x26xSpeeds,
+		Profiles: []string{"baseline", "main", "high", "high10", "high422", "high444"},
+		Formats:  []string{"mp4", "mov", "mkv", "mpegts"},
+	},
+	"libx265": {
+		Name: "libx265", CRF: [2]float64{0, 51}, Speeds: x26xSpeeds,
+		Profiles: []string{"main", "main10", "main12", "main422-10", "main444-8", "main444-10"},
+		Formats:  []string{"mp4", "mov", "mkv", "mpegts"},
+	},
+	"libvpx-vp9": {
+		Name: "libvpx-vp9", CRF: [2]float64{0, 63},
+		Formats: []string{"webm", "mkv", "mp4"},
+	},
+	"libaom-av1": {
+		Name: "libaom-av1", CRF: [2]float64{0, 63},
+		Formats: []string{"mp4", "mkv", "webm"},
+	},
+	"prores_ks": {
+		Name:     "prores_ks",
+		Profiles: []string{"proxy", "lt", "standard", "hq", "4444", "4444xq"},
+		PixFmts:  []string{"yuv422p10le", "yuv444p10le"},
+		Formats:  []string{"mov", "mkv"},
+	},
+	"gif": {
+		Name:    "gif",
+		PixFmts: []string{"pal8"},
+		Formats: []string{"gif"},
+	},
+	"png": {
+		Name:    "png",
+		PixFmts: []string{"rgb24", "rgba", "rgb48be"},
+		Formats: []string{"frames"},
+	},
+	"mjpeg": {
+		Name:    "mjpeg",
+		PixFmts: []string{"yuvj420p", "yuvj444p"},
+		Formats: []string{"frames"},
+	},
+	"tiff": {
+		Name:    "tiff",
+		PixFmts: []string{"rgb24", "rgb48le"},
+		Formats: []string{"frames"},
+	},
+	"bmp": {
+		Name:    "bmp",
+		PixFmts: []string{"bgr24"},
+		Formats: []string{"frames"},
+	},
+	"libwebp": {
+		Name:    "libwebp",
+		PixFmts: []string{"yuv420p", "yuva420p"},
+		Formats: []string{"webp"},
+	},
+	"aac": {
+		Name: "aac", Audio: true,
+		Formats: []string{"mp4", "mov", "mkv", "mpegts", "m4a"},
+	},
+	"libopus": {
+		Name: "libopus", Audio: true,
+		Formats: []string{"webm", "mkv", "mp4", "ogg", "opus"},
+	},
+	"libmp3lame": {
+		Name: "libmp3lame", Audio: true,
+		Formats: []string{"mp4", "mov", "mkv", "mpegts", "mp3"},
+	},
+	"flac": {
+		Name: "flac", Audio: true,
+		Formats: []string{"mkv", "mp4", "flac"},
+	},
+	"pcm_s16le": {
+		Name: "pcm_s16le", Audio: true,
+		Formats: []string{"mov", "mkv", "wav"},
+	},
+}
+
+// Container is a format export can write
+type Container struct {
+	Muxer  string // ffmpeg muxer name
+	VCodec string // default video encoder
+	ACodec string // default audio encoder, empty when it can't hold audio
+
+	// Animated marks an image format, encoded at the width of the canvas
+	// keeping the aspect ratio, never copied into
+	Animated bool
+	// AudioOnly marks a format without video, never copied into
+	AudioOnly bool
+}
+
+// Containers are the container formats export writes, by name
+var Containers = map[string]Container{
+	"mp4":    {Muxer: "mp4", VCodec: "libx264", ACodec: "aac"},
+	"mov":    {Muxer: "mov", VCodec: "libx264", ACodec: "aac"},
+	"mkv":    {Muxer: "matroska", VCodec: "libx264", ACodec: "aac"},
+	"webm":   {Muxer: "webm", VCodec: "libvpx-vp9", ACodec: "libopus"},
+	"mpegts": {Muxer: "mpegts", VCodec: "libx264", ACodec: "aac"},
+	"gif":    {Muxer: "gif", VCodec: "gif", Animated: true},
+	"webp":   {Muxer: "webp", VCodec: "libwebp", Animated: true},
+	"frames": {Muxer: "image2"}, // numbered images, the encoder follows the extension
+	"mp3":    {Muxer: "mp3", ACodec: "libmp3lame", AudioOnly: true},
+	"wav":    {Muxer: "wav", ACodec: "pcm_s16le", AudioOnly: true},
+	"flac":   {Muxer: "flac", ACodec: "flac", AudioOnly: true},
+	"m4a":    {Muxer: "ipod", ACodec: "aac", AudioOnly: true},
+	"ogg":    {Muxer: "ogg", ACodec: "libopus", AudioOnly: true},
+	"opus":   {Muxer: "opus", ACodec: "libopus", AudioOnly: true},
+}
+
+// encoderNames lists the encoders of one kind, sorted, plus copy
+func encoderNames(audio bool) []string {
+	names := []string{"copy"}
+	for name, enc := range Encoders {
+		if enc.Audio == audio {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// containerNames lists the container formats, sorted
+func containerNames() []string {
+	names := make([]string, 0, len(Containers))
+	for name := range Containers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
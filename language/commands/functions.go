@@ -0,0 +1,60 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Function describes a builtin function. Functions are called like
+// commands, but inside expressions: they take a fixed number of
+// positional arguments and return a value instead of a stream.
+type Function struct {
+	Signature
+	Result Type
+}
+
+// Usage returns a one line synopsis such as `env name:string -> string`
+func (f Function) Usage() string {
+	return fmt.Sprintf("%s -> %s", f.Signature.Usage(), f.Result)
+}
+
+var functions = make(map[string]Function)
+
+// RegisterFunction adds a function, it panics on duplicates, on names
+// taken by commands and on optional or variadic parameters
+func RegisterFunction(fn Function) {
+	if _, ok := functions[fn.Name]; ok {
+		panic(fmt.Sprintf("commands: function %s registered twice", fn.Name))
+	}
+	if IsCommand(fn.Name) {
+		panic(fmt.Sprintf("commands: function %s has the name of a command", fn.Name))
+	}
+	for _, p := range fn.Params {
+		if p.Variadic || !p.Required() {
+			panic(fmt.Sprintf("commands: function %s: parameter %s must be required and not variadic", fn.Name, p.Name))
+		}
+	}
+	functions[fn.Name] = fn
+}
+
+// LookupFunction returns the description of a function
+func LookupFunction(name string) (Function, bool) {
+	fn, ok := functions[name]
+	return fn, ok
+}
+
+// IsFunction reports whether name is a registered function
+func IsFunction(name string) bool {
+	_, ok := functions[name]
+	return ok
+}
+
+// AllFunctions returns every registered function sorted by name
+func AllFunctions() []Function {
+	fns := make([]Function, 0, len(functions))
+	for _, fn := range functions {
+		fns = append(fns, fn)
+	}
+	sort.Slice(fns, func(i, j int) bool { return fns[i].Name < fns[j].Name })
+	return fns
+}
@@ -0,0 +1,54 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// WriteHelp lists every command and function with its synopsis and
+// description
+func WriteHelp(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, sig := range All() {
+		fmt.Fprintf(tw, "%s\t%s\n", sig.Synopsis(), sig.Description)
+	}
+	fmt.Fprintln(tw, "\nFunctions:")
+	for _, fn := range AllFunctions() {
+		fmt.Fprintf(tw, "%s\t%s\n", fn.Usage(), fn.Description)
+	}
+	return tw.Flush()
+}
+
+// WriteCommandHelp describes a single command or function and each of its
+// parameters
+func WriteCommandHelp(w io.Writer, name string) error {
+	sig, ok := Lookup(name)
+	usage := sig.Usage()
+	if !ok {
+		fn, isFn := LookupFunction(name)
+		if !isFn {
+			return fmt.Errorf("unknown command: %s", name)
+		}
+		sig, usage = fn.Signature, fn.Usage()
+	}
+
+	fmt.Fprintf(w, "%s\n\n%s\n", usage, sig.Description)
+	if sig.Input {
+		fmt.Fprintln(w, "Transforms the stream piped into it.")
+	}
+	if len(sig.Params) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(w, "\nParameters:")
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, p := range sig.Params {
+		desc := p.Description
+		if p.Default != nil {
+			desc = fmt.Sprintf("%s (default %v)", desc, p.Default)
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\n", p.Name, p.Type, desc)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,200 @@
+package interpreter
+
+import (
+	"fmt"
+
+	"github.com/andyp1xe1/vidlang/language/commands"
+	"github.com/andyp1xe1/vidlang/language/parser"
+)
+
+// streamArg is a stream argument together with whether it can be copied
+type streamArg struct {
+	entry   interface{}
+	canCopy bool
+}
+
+// cmdArgs holds the arguments of a command, validated against its
+// signature and bound to the parameter names
+type cmdArgs struct {
+	sig    commands.Signature
+	values map[string]any
+}
+
+// bindArgs validates positional and named arguments against a signature,
+// resolves variables and fills in defaults
+func bindArgs(ctx *Context, sig commands.Signature, args []parser.NodeValue) (cmdArgs, error) {
+	bound := cmdArgs{sig: sig, values: make(map[string]any)}
+
+	values, names := splitNamedArgs(args)
+	slots, err := sig.Assign(names)
+	if err != nil {
+		return bound, err
+	}
+
+	for i, param := range sig.Params {
+		if len(slots[i]) == 0 {
+			bound.values[param.Name] = param.Default
+			continue
+		}
+
+		if param.Variadic {
+			rest := make([]any, 0, len(slots[i]))
+			for _, idx := range slots[i] {
+				if items, ok, err := bindListArg(ctx, param, values[idx]); ok {
+					if err != nil {
+						return bound, fmt.Errorf("command %s: argument %s: %v", sig.Name, param.Name, err)
+					}
+					rest = append(rest, items...)
+					continue
+				}
+				v, err := bindArg(ctx, param, values[idx])
+				if err != nil {
+					return bound, fmt.Errorf("command %s: argument %s: %v", sig.Name, param.Name, err)
+				}
+				rest = append(rest, v)
+			}
+			bound.values[param.Name] = rest
+			continue
+		}
+
+		v, err := bindArg(ctx, param, values[slots[i][0]])
+		if err != nil {
+			return bound, fmt.Errorf("command %s: argument %s: %v", sig.Name, param.Name, err)
+		}
+		bound.values[param.Name] = v
+	}
+
+	return bound, nil
+}
+
+// splitNamedArgs unwraps `name=value` arguments, returning every value and
+// the name it was given with, "" for positional ones
+func splitNamedArgs(args []parser.NodeValue) ([]parser.NodeValue, []string) {
+	values := make([]parser.NodeValue, 0, len(args))
+	names := make([]string, 0, len(args))
+	for _, arg := range args {
+		if named, ok := arg.(parser.NodeNamedArg); ok {
+			values = append(values, named.Value)
+			names = append(names, named.Name)
+			continue
+		}
+		values = append(values, arg)
+		names = append(names, "")
+	}
+	return values, names
+}
+
+func bindArg(ctx *Context, param commands.Param, arg parser.NodeValue) (any, error) {
+	arg = keywordArg(param, arg)
+	switch param.Type {
+	case commands.TypeStream:
+		entry, canCopy, err := getStreamArg(ctx, arg)
+		if err != nil {
+			return nil, fmt.Errorf("must be a stream but: %v", err)
+		}
+		return streamArg{entry, canCopy}, nil
+	case commands.TypeNumber:
+		return bindPrimitive(ctx, param, arg, ValueNumber)
+	case commands.TypeString:
+		v, err := bindPrimitive(ctx, param, arg, ValueString)
+		if err != nil {
+			return nil, err
+		}
+		if err := param.CheckEnum(v.(string)); err != nil {
+			return nil, err
+		}
+		return v, nil
+	case commands.TypeBool:
+		return bindPrimitive(ctx, param, arg, ValueBool)
+	case commands.TypeAny:
+		box, err := evalValue(ctx, arg)
+		if err != nil {
+			return nil, err
+		}
+		if v := boxToPrimitive(box); v != nil {
+			return v, nil
+		}
+		return nil, fmt.Errorf("must be a bool, number or string but got %v", box.typ)
+	}
+	return nil, fmt.Errorf("parameters of type %s are not supported", param.Type)
+}
+
+// bindListArg spreads a list of streams given to a variadic stream
+// parameter, ok is false when the argument is not such a list
+func bindListArg(ctx *Context, param commands.Param, arg parser.NodeValue) (items []any, ok bool, err error) {
+	if param.Type != commands.TypeStream {
+		return nil, false, nil
+	}
+	switch v := arg.(type) {
+	case parser.NodeIdent, parser.NodeVar:
+		if name, _ := parser.VarName(v); ctx.isStream(name) {
+			return nil, false, nil
+		}
+	case parser.NodeList[parser.NodeValue]:
+	default:
+		return nil, false, nil
+	}
+
+	box, err := evalValue(ctx, arg)
+	if err != nil {
+		return nil, true, err
+	}
+	if box.typ != ValueList {
+		return nil, true, fmt.Errorf("must be a stream or a list of streams but got %v", box.typ)
+	}
+	for _, item := range box.any.([]ValueBox) {
+		if item.typ != ValueStream {
+			return nil, true, fmt.Errorf("list item must be a stream but got %v", item.typ)
+		}
+		items = append(items, item.any.(streamArg))
+	}
+	return items, true, nil
+}
+
+func bindPrimitive(ctx *Context, param commands.Param, arg parser.NodeValue, typ valueType) (any, error) {
+	box, err := getArg(ctx, arg, typ)
+	if err != nil {
+		return nil, fmt.Errorf("must be a %s but: %v", param.Type, err)
+	}
+	return boxToPrimitive(box), nil
+}
+
+func (a cmdArgs) number(name string) float64 {
+	return a.values[name].(float64)
+}
+
+func (a cmdArgs) string(name string) string {
+	return a.values[name].(string)
+}
+
+func (a cmdArgs) bool(name string) bool {
+	return a.values[name].(bool)
+}
+
+// value is an argument of type any, a bool, float64 or string
+func (a cmdArgs) value(name string) any {
+	return a.values[name]
+}
+
+func (a cmdArgs) stream(name string) streamArg {
+	return a.values[name].(streamArg)
+}
+
+// streams returns the stream arguments collected by a variadic parameter
+func (a cmdArgs) streams(name string) []streamArg {
+	rest := a.values[name].([]any)
+	res := make([]streamArg, 0, len(rest))
+	for _, v := range rest {
+		res = append(res, v.(streamArg))
+	}
+	return res
+}
+
+// keywordArg turns a bare word that is a keyword of the parameter into a
+// string, keywords win over variables of the same name
+func keywordArg(param commands.Param, arg parser.NodeValue) parser.NodeValue {
+	if ident, ok := parser.VarName(arg); ok && param.IsKeyword(string(ident)) {
+		return parser.NodeLiteralString(ident)
+	}
+	return arg
+}
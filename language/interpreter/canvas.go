@@ -0,0 +1,114 @@
+package interpreter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Canvas is the project format every clip is normalized to when clips are
+// combined, and the format exports are encoded in
+type Canvas struct {
+	Width      int     `json:"width"`
+	Height     int     `json:"height"`
+	FPS        float64 `json:"fps"`
+	PixFmt     string  `json:"pixfmt"`
+	SampleRate int     `json:"samplerate"`
+}
+
+var defaultCanvas = Canvas{
+	Width:      1920,
+	Height:     1080,
+	FPS:        30,
+	PixFmt:     "yuv420p",
+	SampleRate: 48000,
+}
+
+// with returns c with the fields set in o, zero fields are kept
+func (c Canvas) with(o Canvas) Canvas {
+	if o.Width != 0 {
+		c.Width = o.Width
+	}
+	if o.Height != 0 {
+		c.Height = o.Height
+	}
+	if o.FPS != 0 {
+		c.FPS = o.FPS
+	}
+	if o.PixFmt != "" {
+		c.PixFmt = o.PixFmt
+	}
+	if o.SampleRate != 0 {
+		c.SampleRate = o.SampleRate
+	}
+	return c
+}
+
+// validate rejects sizes and rates encoders can't work with
+func (c Canvas) validate() error {
+	if c.Width <= 0 || c.Height <= 0 {
+		return fmt.Errorf("canvas size must be positive, got %dx%d", c.Width, c.Height)
+	}
+	if c.Width%2 != 0 || c.Height%2 != 0 {
+		return fmt.Errorf("canvas size must be even, got %dx%d", c.Width, c.Height)
+	}
+	if c.FPS <= 0 {
+		return fmt.Errorf("canvas frame rate must be positive, got %v", c.FPS)
+	}
+	if c.SampleRate <= 0 {
+		return fmt.Errorf("canvas sample rate must be positive, got %v", c.SampleRate)
+	}
+	return nil
+}
+
+// size is the frame size as ffmpeg's -s option takes it
+func (c Canvas) size() string {
+	return fmt.Sprintf("%dx%d", c.Width, c.Height)
+}
+
+// ParseCanvas reads a canvas given as WIDTHxHEIGHT or WIDTHxHEIGHT@FPS,
+// fields it doesn't set are left zero
+func ParseCanvas(s string) (Canvas, error) {
+	var c Canvas
+	size, fps, hasFPS := strings.Cut(s, "@")
+	w, h, ok := strings.Cut(size, "x")
+	if !ok {
+		return c, fmt.Errorf("expected WIDTHxHEIGHT[@FPS], got %q", s)
+	}
+	var err error
+	if c.Width, err = strconv.Atoi(w); err != nil {
+		return c, fmt.Errorf("invalid canvas width %q", w)
+	}
+	if c.Height, err = strconv.Atoi(h); err != nil {
+		return c, fmt.Errorf("invalid canvas height %q", h)
+	}
+	if hasFPS {
+		if c.FPS, err = strconv.ParseFloat(fps, 64); err != nil {
+			return c, fmt.Errorf("invalid canvas frame rate %q", fps)
+		}
+	}
+	return c, nil
+}
+
+// canvasArgs reads canvas fields from command arguments, zero meaning
+// the field is not given
+func canvasArgs(args cmdArgs) Canvas {
+	return Canvas{
+		Width:      int(args.number("width")),
+		Height:     int(args.number("height")),
+		FPS:        args.number("fps"),
+		PixFmt:     args.string("pixfmt"),
+		SampleRate: int(args.number("samplerate")),
+	}
+}
+
+// cmdCanvas implements the canvas directive, it changes the canvas for
+// the rest of the script
+func cmdCanvas(ctx *Context, args cmdArgs) error {
+	c := ctx.canvas.with(canvasArgs(args))
+	if err := c.validate(); err != nil {
+		return err
+	}
+	*ctx.canvas = c
+	return nil
+}
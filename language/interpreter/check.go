@@ -0,0 +1,712 @@
+package interpreter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/andyp1xe1/vidlang/language/commands"
+	"github.com/andyp1xe1/vidlang/language/parser"
+)
+
+// CheckError is a single problem found by the static checker, at a 1-based
+// line and column. File is set when it is in an imported script.
+type CheckError struct {
+	Message string
+	File    string
+	Line    int
+	Pos     int
+}
+
+func (e CheckError) Error() string {
+	if e.File != "" {
+		return fmt.Sprintf("%s: %s at %d:%d", e.File, e.Message, e.Line, e.Pos)
+	}
+	return fmt.Sprintf("%s at %d:%d", e.Message, e.Line, e.Pos)
+}
+
+// CheckErrors holds every problem found in a script, in source order
+type CheckErrors []CheckError
+
+func (e CheckErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%d problem(s) found:\n%s", len(e), strings.Join(msgs, "\n"))
+}
+
+// symKind is what the checker knows about the value behind a name
+type symKind int
+
+const (
+	kindUnknown symKind = iota
+	kindBool
+	kindNumber
+	kindString
+	kindStream
+	kindList
+	kindSubExpr
+)
+
+func (k symKind) String() string {
+	switch k {
+	case kindBool:
+		return "bool"
+	case kindNumber:
+		return "number"
+	case kindString:
+		return "string"
+	case kindStream:
+		return "stream"
+	case kindList:
+		return "list"
+	case kindSubExpr:
+		return "subexpression"
+	}
+	return "unknown"
+}
+
+// boxKind maps the type of a runtime value onto what the checker tracks
+func boxKind(box ValueBox) symKind {
+	switch box.typ {
+	case ValueBool:
+		return kindBool
+	case ValueNumber:
+		return kindNumber
+	case ValueString:
+		return kindString
+	case ValueList:
+		return kindList
+	case ValueSubExpr:
+		return kindSubExpr
+	case ValueStream:
+		return kindStream
+	}
+	return kindUnknown
+}
+
+// kindOf maps a parameter type onto what the checker tracks
+func kindOf(t commands.Type) symKind {
+	switch t {
+	case commands.TypeBool:
+		return kindBool
+	case commands.TypeNumber:
+		return kindNumber
+	case commands.TypeString:
+		return kindString
+	case commands.TypeStream:
+		return kindStream
+	case commands.TypeList:
+		return kindList
+	}
+	return kindUnknown
+}
+
+type checker struct {
+	scope map[parser.NodeIdent]symKind
+	maybe map[parser.NodeIdent]bool // defined on some paths through an if only
+	errs  CheckErrors
+	pos   parser.Pos
+
+	file    string
+	prog    *program
+	modules map[string]*checker // checked imports, holding their top level scope
+	presets map[string]Preset   // export presets by name, builtin and from the config
+}
+
+// CheckNodes statically checks top level nodes, and the scripts they
+// import, without running anything. It returns CheckErrors listing every
+// problem, or nil. Imports are resolved against opts.Path.
+func CheckNodes(nodes []parser.Node, opts Options) error {
+	prog, err := loadProgram(nodes, opts.Path)
+	if err != nil {
+		return err
+	}
+	globals, err := scriptGlobals(opts)
+	if err != nil {
+		return err
+	}
+	return checkProgram(prog, globals, presetTable(opts.Config.Presets))
+}
+
+// Check parses the script and statically checks it without running it
+func Check(code string, opts Options) error {
+	nodes, err := parseScript(code)
+	if err != nil {
+		return err
+	}
+	return CheckNodes(nodes, opts)
+}
+
+// checkProgram checks the main script with the command line parameters in
+// scope, imported scripts don't see them
+func checkProgram(prog *program, globals map[parser.NodeIdent]ValueBox, presets map[string]Preset) error {
+	c := &checker{
+		scope:   make(map[parser.NodeIdent]symKind),
+		maybe:   make(map[parser.NodeIdent]bool),
+		file:    prog.main.path,
+		prog:    prog,
+		modules: make(map[string]*checker),
+		presets: presets,
+	}
+	for name, box := range globals {
+		c.scope[name] = boxKind(box)
+	}
+	for _, n := range prog.main.nodes {
+		c.checkNode(n)
+	}
+	if len(c.errs) > 0 {
+		return c.errs
+	}
+	return nil
+}
+
+// at makes errors point at a node that records where it starts, it
+// returns a function going back to the previous position
+func (c *checker) at(n parser.Node) func() {
+	prev := c.pos
+	if pos, ok := parser.PosOf(n); ok && pos.Line > 0 {
+		c.pos = pos
+	}
+	return func() { c.pos = prev }
+}
+
+func (c *checker) errorf(format string, args ...any) {
+	c.errs = append(c.errs, CheckError{
+		Message: fmt.Sprintf(format, args...),
+		File:    c.errFile(),
+		Line:    c.pos.Line,
+		Pos:     c.pos.Column,
+	})
+}
+
+// errFile is the file errors are attributed to, the main script is
+// left out to keep its messages short
+func (c *checker) errFile() string {
+	if c.file == c.prog.main.path {
+		return ""
+	}
+	return c.file
+}
+
+func (c *checker) checkNode(node parser.Node) {
+	switch n := node.(type) {
+	case parser.NodeAssign:
+		c.pos = n.Pos
+		c.checkAssign(n)
+	case parser.NodeExpr:
+		c.pos = n.Pos
+		if _, ok := directive(n); ok {
+			c.checkDirective(n)
+			return
+		}
+		c.checkExpr(n)
+		c.define(globalStreamName, kindStream)
+	case parser.NodeIf:
+		c.pos = n.Pos
+		c.checkIf(n)
+	case parser.NodeFor:
+		c.pos = n.Pos
+		c.checkFor(n)
+	case parser.NodeImport:
+		c.pos = n.Pos
+		c.checkImport(n)
+	case parser.AstError:
+		c.errs = append(c.errs, CheckError{Message: n.Message, File: c.errFile(), Line: n.Line, Pos: n.Pos})
+	default:
+		c.errorf("unsupported node type: %T", node)
+	}
+}
+
+func (c *checker) checkAssign(node parser.NodeAssign) {
+	if len(node.Dest) == 0 {
+		c.errorf("invalid assignment: no destination")
+		return
+	}
+	if len(node.Dest) > 1 {
+		c.errorf("cannot assign to multiple variables for now")
+	}
+
+	kind := c.checkValue(node.Value)
+	for _, v := range condBranches(node.Value) {
+		if ident, ok := parser.VarName(v); ok && c.scope[ident] == kindStream {
+			restore := c.at(v)
+			c.errorf("stream %s can't be assigned directly, pipe it through a command instead", ident)
+			restore()
+			break
+		}
+	}
+
+	for _, dest := range node.Dest {
+		c.checkDefine(dest)
+		c.define(dest, kind)
+	}
+}
+
+// defined reports whether a name is known, on some path at least
+func (c *checker) defined(name parser.NodeIdent) bool {
+	_, ok := c.scope[name]
+	return ok || c.maybe[name]
+}
+
+// define records a name as defined on every path from here on
+func (c *checker) define(name parser.NodeIdent, kind symKind) {
+	c.scope[name] = kind
+	delete(c.maybe, name)
+}
+
+// checkImport checks the imported script once and defines its top level
+// names under the alias
+func (c *checker) checkImport(node parser.NodeImport) {
+	path := resolveImport(c.file, node.Path)
+	sub, ok := c.modules[path]
+	if !ok {
+		mod, loaded := c.prog.modules[path]
+		if !loaded {
+			c.errorf("import %s was not loaded", node.Path)
+			return
+		}
+		sub = &checker{
+			scope:   make(map[parser.NodeIdent]symKind),
+			maybe:   make(map[parser.NodeIdent]bool),
+			file:    path,
+			prog:    c.prog,
+			modules: c.modules,
+			presets: c.presets,
+		}
+		for _, n := range mod.nodes {
+			sub.checkNode(n)
+		}
+		c.errs = append(c.errs, sub.errs...)
+		c.modules[path] = sub
+	}
+
+	for name, kind := range sub.scope {
+		if name != globalStreamName {
+			c.define(qualify(node.Alias, name), kind)
+		}
+	}
+	for name := range sub.maybe {
+		c.maybe[qualify(node.Alias, name)] = true
+	}
+}
+
+// checkDefine reports names that can't be defined in a script
+func (c *checker) checkDefine(name parser.NodeIdent) {
+	if isQualified(name) {
+		c.errorf("cannot assign to %s, definitions of imported scripts are read only", name)
+	}
+}
+
+// checkIf checks both branches, a missing else being an empty one. Blocks
+// share the enclosing scope, so a name defined in both branches is known
+// after the statement, and one defined in only one of them is possibly
+// undefined.
+func (c *checker) checkIf(node parser.NodeIf) {
+	c.expectKind(node.Cond, kindBool, "if condition")
+
+	outer, outerMaybe := c.scope, c.maybe
+	scopes := make([]map[parser.NodeIdent]symKind, 0, 2)
+	maybe := copyMaybe(outerMaybe)
+	for _, body := range [][]parser.Node{node.Then, node.Else} {
+		c.scope, c.maybe = copyScope(outer), copyMaybe(outerMaybe)
+		for _, stmt := range body {
+			c.checkNode(stmt)
+		}
+		scopes = append(scopes, c.scope)
+		for name := range c.maybe {
+			maybe[name] = true
+		}
+	}
+
+	c.scope, c.maybe = make(map[parser.NodeIdent]symKind, len(outer)), maybe
+	then, els := scopes[0], scopes[1]
+	for name, kind := range then {
+		other, ok := els[name]
+		if !ok {
+			c.maybe[name] = true
+			continue
+		}
+		if other != kind {
+			kind = kindUnknown
+		}
+		c.define(name, kind)
+	}
+	for name := range els {
+		if _, ok := then[name]; !ok {
+			c.maybe[name] = true
+		}
+	}
+}
+
+// checkFor checks the loop body in its own scope holding the loop
+// variables, names it defines are gone after the loop
+func (c *checker) checkFor(node parser.NodeFor) {
+	elem := kindUnknown
+	switch kind := c.checkValue(node.Iter); kind {
+	case kindStream:
+		elem = kindStream
+	case kindList:
+		elem = c.elemKind(node.Iter)
+	case kindUnknown:
+	default:
+		c.errorf("cannot iterate over %s %s", kind, node.Iter)
+	}
+
+	outer, outerMaybe := c.scope, c.maybe
+	c.scope, c.maybe = copyScope(outer), copyMaybe(outerMaybe)
+	if node.Index != "" {
+		c.checkDefine(node.Index)
+		c.define(node.Index, kindNumber)
+	}
+	c.checkDefine(node.Value)
+	c.define(node.Value, elem)
+	for _, stmt := range node.Body {
+		c.checkNode(stmt)
+	}
+	c.scope, c.maybe = outer, outerMaybe
+}
+
+// elemKind returns the kind of the items of a list value when it is
+// known without running the script
+func (c *checker) elemKind(v parser.NodeValue) symKind {
+	switch n := v.(type) {
+	case parser.NodeExprMath:
+		if n.Op == parser.OpRange {
+			return kindNumber
+		}
+	case parser.NodeList[parser.NodeValue]:
+		kind := kindUnknown
+		for i, item := range n {
+			k := c.peekKind(item)
+			if i > 0 && k != kind {
+				return kindUnknown
+			}
+			kind = k
+		}
+		return kind
+	}
+	return kindUnknown
+}
+
+// peekKind is checkValue for values without children, reporting nothing
+func (c *checker) peekKind(v parser.NodeValue) symKind {
+	switch n := v.(type) {
+	case parser.NodeLiteralBool:
+		return kindBool
+	case parser.NodeLiteralNumber:
+		return kindNumber
+	case parser.NodeLiteralString, parser.NodeInterpolation:
+		return kindString
+	case parser.NodeIdent, parser.NodeVar:
+		name, _ := parser.VarName(n)
+		return c.scope[name]
+	case parser.NodeList[parser.NodeValue]:
+		return kindList
+	}
+	return kindUnknown
+}
+
+// condBranches lists the values an inline conditional may end up as, or
+// the value itself when it is not a conditional
+func condBranches(v parser.NodeValue) []parser.NodeValue {
+	cond, ok := v.(parser.NodeCond)
+	if !ok {
+		return []parser.NodeValue{v}
+	}
+	return append(condBranches(cond.Then), condBranches(cond.Else)...)
+}
+
+func copyMaybe(maybe map[parser.NodeIdent]bool) map[parser.NodeIdent]bool {
+	res := make(map[parser.NodeIdent]bool, len(maybe))
+	for k := range maybe {
+		res[k] = true
+	}
+	return res
+}
+
+func copyScope(scope map[parser.NodeIdent]symKind) map[parser.NodeIdent]symKind {
+	res := make(map[parser.NodeIdent]symKind, len(scope))
+	for k, v := range scope {
+		res[k] = v
+	}
+	return res
+}
+
+// checkExpr checks a pipeline, an expression always evaluates to a stream
+func (c *checker) checkExpr(expr parser.NodeExpr) symKind {
+	hasInput := false
+
+	if len(expr.Input) > 1 {
+		c.errorf("multiple literal inputs not supported yet")
+	}
+	if len(expr.Input) == 1 {
+		hasInput = true
+		switch v := expr.Input[0].(type) {
+		case parser.NodeIdent, parser.NodeVar, parser.NodeIndex:
+			c.expectKind(v, kindStream, "pipeline input")
+		default:
+			restore := c.at(v)
+			c.errorf("pipeline input must be a stream variable, got %s", v)
+			restore()
+		}
+	}
+
+	for i, cmd := range expr.Pipeline {
+		c.pos = cmd.Pos
+		if cmd.Name == "open" && i != 0 {
+			c.errorf("open can only start a pipeline")
+			continue
+		}
+		if cmd.Name == "open" && hasInput {
+			c.errorf("open does not take an input stream")
+		}
+		if sig, ok := commands.Lookup(cmd.Name); ok && sig.Directive {
+			// only reached when the directive gives a value or is piped
+			c.errorf("%s must be a statement of its own", cmd.Name)
+			continue
+		}
+		c.checkCommand(cmd, hasInput || i > 0)
+	}
+
+	return kindStream
+}
+
+// checkDirective checks a statement such as canvas, which takes no input
+// and is not part of a pipeline
+func (c *checker) checkDirective(expr parser.NodeExpr) {
+	cmd := expr.Pipeline[0]
+	if len(expr.Input) > 0 || len(expr.Pipeline) > 1 {
+		c.errorf("%s must be a statement of its own", cmd.Name)
+	}
+	c.pos = cmd.Pos
+	c.checkCommand(cmd, false)
+}
+
+func (c *checker) checkCommand(cmd parser.NodeCommand, hasInput bool) {
+	sig, ok := commands.Lookup(cmd.Name)
+	if !ok {
+		c.errorf("unknown command: %s", cmd.Name)
+		return
+	}
+
+	if sig.Input && !hasInput {
+		c.errorf("command %s requires an input stream", cmd.Name)
+	}
+
+	values, names := splitNamedArgs(cmd.Args)
+	slots, err := sig.Assign(names)
+	if err != nil {
+		c.errorf("%v", err)
+		for _, v := range values {
+			c.checkValue(v)
+		}
+		return
+	}
+
+	for i, param := range sig.Params {
+		for _, idx := range slots[i] {
+			c.checkArg(cmd.Name, param, cmd.Args[idx], values[idx])
+		}
+	}
+}
+
+// checkArg checks the value given to a parameter, arg is the argument as
+// written, named or not, which errors point at
+func (c *checker) checkArg(cmdName string, param commands.Param, arg parser.Node, value parser.NodeValue) {
+	defer c.at(arg)()
+	value = keywordArg(param, value)
+	what := fmt.Sprintf("command %s: argument %s", cmdName, param.Name)
+	if param.Variadic && param.Type == commands.TypeStream && c.peekKind(value) == kindList {
+		// a list of streams is spread over the parameter
+		if kind := c.elemKind(value); kind != kindUnknown && kind != kindStream {
+			c.errorf("%s must be a list of streams, but %s holds %s values", what, value, kind)
+		}
+		c.checkValue(value)
+		return
+	}
+	if ident, ok := parser.VarName(value); ok && len(param.Keywords) > 0 && !c.defined(ident) {
+		c.errorf("%s must be a variable or one of %s, got %s", what, strings.Join(param.Keywords, ", "), ident)
+		return
+	}
+	c.expectKind(value, kindOf(param.Type), what)
+
+	if lit, ok := value.(parser.NodeLiteralString); ok {
+		if err := param.CheckEnum(string(lit)); err != nil {
+			c.errorf("%s %v", what, err)
+		}
+		if cmdName == "export" && param.Name == "preset" {
+			if _, err := lookupPreset(c.presets, string(lit)); err != nil {
+				c.errorf("%s: %v", what, err)
+			}
+		}
+	}
+}
+
+func (c *checker) checkCall(call parser.NodeCall) symKind {
+	fn, ok := commands.LookupFunction(call.Name)
+	if !ok {
+		c.errorf("unknown function: %s", call.Name)
+		return kindUnknown
+	}
+	if len(call.Args) != len(fn.Params) {
+		c.errorf("function %s takes %d arguments, got %d", call.Name, len(fn.Params), len(call.Args))
+	}
+	for i, arg := range call.Args {
+		if i >= len(fn.Params) {
+			c.checkValue(arg)
+			continue
+		}
+		c.expectKind(arg, kindOf(fn.Params[i].Type), fmt.Sprintf("function %s: argument %s", call.Name, fn.Params[i].Name))
+	}
+	return kindOf(fn.Result)
+}
+
+// expectKind checks a value and reports when its kind is known and differs
+func (c *checker) expectKind(v parser.NodeValue, want symKind, what string) {
+	got := c.checkValue(v)
+	if got == kindUnknown || got == want {
+		return
+	}
+	if want == kindUnknown {
+		// parameters of type any take any primitive
+		switch got {
+		case kindBool, kindNumber, kindString:
+			return
+		}
+		c.errorf("%s must be a bool, number or string, but %s is a %s", what, v, got)
+		return
+	}
+	if want == kindStream {
+		switch v.(type) {
+		case parser.NodeIdent, parser.NodeVar, parser.NodeIndex:
+		default:
+			c.errorf("%s must be a stream variable, got %s %s", what, got, v)
+			return
+		}
+	}
+	c.errorf("%s must be a %s, but %s is a %s", what, want, v, got)
+}
+
+// checkValue resolves identifiers used by a value and returns its kind
+func (c *checker) checkValue(v parser.NodeValue) symKind {
+	defer c.at(v)()
+	switch n := v.(type) {
+	case parser.NodeLiteralBool:
+		return kindBool
+	case parser.NodeLiteralNumber:
+		return kindNumber
+	case parser.NodeLiteralString:
+		return kindString
+	case parser.NodeInterpolation:
+		for _, part := range n.Parts {
+			if ident, ok := part.(parser.NodeIdent); ok {
+				switch kind := c.checkValue(ident); kind {
+				case kindString, kindNumber, kindUnknown:
+				default:
+					c.errorf("cannot interpolate ${%s}: %s is a %s, expected a string or number", ident, ident, kind)
+				}
+			}
+		}
+		return kindString
+	case parser.NodeSelfStar:
+		c.errorf("`*` is not supported yet")
+		return kindUnknown
+	case parser.NodeIdent, parser.NodeVar:
+		name, _ := parser.VarName(n)
+		if name == selfStarName {
+			c.errorf("`*` is not supported yet")
+			return kindUnknown
+		}
+		kind, ok := c.scope[name]
+		if !ok {
+			if c.maybe[name] {
+				c.errorf("variable %s is possibly undefined, it is not defined on every path through an if", name)
+				return kindUnknown
+			}
+			if name == globalStreamName {
+				c.errorf("global stream used before any expression")
+			} else {
+				c.errorf("variable %s not found", name)
+			}
+			return kindUnknown
+		}
+		return kind
+	case parser.NodeExprMath:
+		switch {
+		case n.Op.IsLogical():
+			c.expectKind(n.Left, kindBool, fmt.Sprintf("operand of %s", n.Op))
+			c.expectKind(n.Right, kindBool, fmt.Sprintf("operand of %s", n.Op))
+			return kindBool
+		case n.Op == parser.OpEq || n.Op == parser.OpNotEq:
+			left, right := c.checkValue(n.Left), c.checkValue(n.Right)
+			if left != kindUnknown && right != kindUnknown && left != right {
+				c.errorf("cannot compare %s %s with %s %s", left, n.Left, right, n.Right)
+			}
+			return kindBool
+		case n.Op == parser.OpRange:
+			c.expectKind(n.Left, kindNumber, "range bound")
+			c.expectKind(n.Right, kindNumber, "range bound")
+			return kindList
+		case n.Op == parser.OpAdd && c.peekKind(n.Left) == kindList:
+			c.expectKind(n.Left, kindList, "list operand")
+			c.expectKind(n.Right, kindList, "list operand")
+			return kindList
+		case n.Op.IsComparison():
+			c.expectKind(n.Left, kindNumber, fmt.Sprintf("operand of %s", n.Op))
+			c.expectKind(n.Right, kindNumber, fmt.Sprintf("operand of %s", n.Op))
+			return kindBool
+		}
+		c.expectKind(n.Left, kindNumber, "math operand")
+		c.expectKind(n.Right, kindNumber, "math operand")
+		return kindNumber
+	case parser.NodeUnary:
+		c.expectKind(n.Operand, kindBool, "operand of not")
+		return kindBool
+	case parser.NodeCall:
+		return c.checkCall(n)
+	case parser.NodeIndex:
+		c.expectKind(n.Index, kindNumber, "index")
+		switch kind := c.checkValue(n.Target); kind {
+		case kindStream:
+			return kindStream
+		case kindList:
+			return c.elemKind(n.Target)
+		case kindUnknown:
+		default:
+			c.errorf("cannot index %s %s", kind, n.Target)
+		}
+		return kindUnknown
+	case parser.NodeCond:
+		c.expectKind(n.Cond, kindBool, "if condition")
+		then, els := c.checkValue(n.Then), c.checkValue(n.Else)
+		if then != els {
+			return kindUnknown
+		}
+		return then
+	case parser.NodeList[parser.NodeValue]:
+		for _, item := range n {
+			c.checkValue(item)
+		}
+		return kindList
+	case parser.NodeSubExpr:
+		outer := c.scope
+		c.scope = copyScope(outer)
+		for _, param := range n.Params {
+			c.scope[param] = kindUnknown
+		}
+		if n.Body != nil {
+			c.checkValue(n.Body)
+		}
+		c.scope = outer
+		return kindSubExpr
+	case parser.NodeExpr:
+		c.checkExpr(n)
+		return kindStream
+	case parser.NodeNamedArg:
+		c.errorf("named argument %s is only allowed in a command", n.Name)
+		return kindUnknown
+	}
+	c.errorf("unsupported value %s", v)
+	return kindUnknown
+}
@@ -0,0 +1,100 @@
+package interpreter
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/andyp1xe1/vidlang/language/parser"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string // one entry per problem, empty for a valid script
+	}{
+		{"valid", "clip := open \"a.mp4\" |> cut 0 5 |> scale width=640 height=360\nexport clip \"out.mp4\"", nil},
+		{"undefined", "a := b", []string{"variable b not found at 1:6"}},
+		{"undefined later", "x := 1\ny := x + 1\nz := w", []string{"variable w not found at 3:6"}},
+		{"too many arguments", "x := open \"a.mp4\" |> brightness 1 2",
+			[]string{"command brightness takes at most 1 positional argument(s), got 2"}},
+		{"missing argument", "x := open \"a.mp4\" |> cut 1", []string{"command cut: missing argument end"}},
+		{"unknown parameter", "x := open \"a.mp4\" |> scale 1 2 foo=3", []string{"command scale has no parameter foo"}},
+		{"argument type", "x := open \"a.mp4\" |> brightness \"a\"",
+			[]string{`command brightness: argument value must be a number, but "a" is a string`}},
+		{"enum", "x := open \"a.mp4\" |> flip \"x\"", []string{`command flip: argument direction must be one of`}},
+		{"stream assigned", "x := open \"a.mp4\"\ny := x", []string{"stream x can't be assigned directly"}},
+		{"literal as input", "x := 1\ny := x |> brightness 1", []string{"pipeline input must be a stream, but x is a number"}},
+		{"no input", "x := brightness 1", []string{"command brightness requires an input stream"}},
+		{"literal for stream", "d := duration 5", []string{"function duration: argument clip must be a stream variable"}},
+		{"math type", "x := 1 + \"a\"", []string{`math operand must be a number, but "a" is a string`}},
+		{"condition type", "if 1 {\n}", []string{"if condition must be a bool"}},
+		{"if without else", "x := 0\nif x > 0 {\n\ty := 2\n}\nz := y + 1",
+			[]string{"variable y is possibly undefined"}},
+		{"if in one branch", "x := 0\nif x > 0 {\n\ty := 2\n} else {\n\tw := 1\n}\nz := y + w",
+			[]string{"variable y is possibly undefined", "variable w is possibly undefined"}},
+		{"if in every branch", "x := 0\nif x > 0 {\n\ty := 2\n} else if x < 0 {\n\ty := 3\n} else {\n\ty := 4\n}\nz := y + 1", nil},
+		{"if redefined after", "x := 0\nif x > 0 {\n\ty := 2\n}\ny := 3\nz := y", nil},
+		{"text keywords", "x := open \"a.mp4\" |> text \"hi\" x=right y=bottom\ny := x |> text \"hi\" left \"top\"", nil},
+		{"text keyword typo", "x := open \"a.mp4\" |> text \"hi\" x=middle",
+			[]string{"command text: argument x must be a variable or one of left, center, right, got middle at 1:32"}},
+		{"argument position", "x := open \"a.mp4\" |> cut 0 (1 + y)", []string{"variable y not found at 1:33"}},
+		{"stream assigned position", "x := open \"a.mp4\"\ny := if true then 1 else x",
+			[]string{"stream x can't be assigned directly, pipe it through a command instead at 2:26"}},
+		{"preset", "x := open \"a.mp4\"\nexport x \"o.mp4\" preset=\"web\"", nil},
+		{"unknown preset", "x := open \"a.mp4\"\nexport x \"o.mp4\" preset=\"tv\"",
+			[]string{`command export: argument preset: unknown preset "tv", known presets are archive, gif,`}},
+		{"speed as preset", "x := open \"a.mp4\"\nexport x \"o.mp4\" crf=20 preset=\"slow\"",
+			[]string{`unknown preset "slow", the encoder speed is set with speed="slow"`}},
+		{"every problem", "a := b\nx := open \"a.mp4\" |> cut 1\ny := c", []string{
+			"variable b not found at 1:6",
+			"command cut: missing argument end",
+			"variable c not found at 3:6",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Check(tt.script, Options{})
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("Check(%q) = %v, want no problems", tt.script, err)
+				}
+				return
+			}
+			var problems CheckErrors
+			if !errors.As(err, &problems) {
+				t.Fatalf("Check(%q) = %v, want CheckErrors", tt.script, err)
+			}
+			if len(problems) != len(tt.want) {
+				t.Fatalf("Check(%q) found %d problem(s), want %d:\n%v", tt.script, len(problems), len(tt.want), err)
+			}
+			for i, want := range tt.want {
+				if got := problems[i].Error(); !strings.Contains(got, want) {
+					t.Errorf("problem %d of %q is %q, want it to contain %q", i, tt.script, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckConfigPreset(t *testing.T) {
+	opts := Options{Config: Config{Presets: map[string]Preset{"slow": {VCodec: "libx264", Speed: "slow"}}}}
+	script := "x := open \"a.mp4\"\nexport x \"o.mp4\" preset=\"slow\""
+	if err := Check(script, opts); err != nil {
+		t.Errorf("Check with a config preset named slow = %v", err)
+	}
+}
+
+func TestCheckUnknownCommand(t *testing.T) {
+	// the parser only reads registered commands, an AST from JSON may hold others
+	nodes := []parser.Node{parser.NodeAssign{
+		Dest:   parser.NodeList[parser.NodeIdent]{"x"},
+		Value:  parser.NodeExpr{Pipeline: parser.NodePipeline{{Name: "nosuch"}}},
+		Define: true,
+	}}
+	err := CheckNodes(nodes, Options{})
+	if err == nil || !strings.Contains(err.Error(), "unknown command: nosuch") {
+		t.Errorf("CheckNodes = %v, want an unknown command error", err)
+	}
+}
@@ -1,9 +1,7 @@
 package main
 
 import (
-	"bufio"
 	"flag"
-	"io"
 	"log"
 	"os"
 
@@ -11,60 +9,32 @@ import (
 )
 
 func main() {
-
-	var fileName string
-	var useStdin bool
-	var debug bool
-	var nopreview bool
-	flag.StringVar(&fileName, "script", "", "script file to parse")
-	flag.BoolVar(&useStdin, "stdin", false, "read script from stdin")
-	flag.BoolVar(&debug, "debug", false, "enable debug mode")
-	flag.BoolVar(&nopreview, "nopreview", false, "enable debug mode")
-
+	flags := interpreter.RegisterFlags(flag.CommandLine)
 	flag.Parse()
 
-	if len(fileName) == 0 && !useStdin {
+	opts, err := flags.Options(flag.Args())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(flags.Script) == 0 && !flags.Stdin {
 		flag.Usage()
 		os.Exit(1)
 	}
 
-	var script string
-	var err error
+	script, err := flags.ReadScript()
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	if useStdin {
-		if script, err = readStdin(); err != nil {
-			log.Fatalf("Failed to read stdin: %s", err)
-		}
-	} else {
-		if script, err = readFile(fileName); err != nil {
-			log.Fatalf("Failed to read script file: %s", err)
+	if flags.Check {
+		if err := interpreter.Check(script, opts); err != nil {
+			log.Fatalf("Check failed: %v", err)
 		}
+		return
 	}
 
-	if err := interpreter.Interpret(script, debug, !nopreview); err != nil {
+	if err := interpreter.Interpret(script, opts); err != nil {
 		log.Fatalf("Failed to interpret script: %v", err)
 	}
 }
-
-func readFile(fileName string) (string, error) {
-	res, err := os.ReadFile(fileName)
-	if err != nil {
-		return "", err
-	}
-	return string(res), nil
-}
-
-func readStdin() (string, error) {
-	var script string
-	reader := bufio.NewReader(os.Stdin)
-	for {
-		line, err := reader.ReadString('\n')
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			return "", err
-		}
-		script += line
-	}
-	return script, nil
-}
@@ -3,292 +3,559 @@ package interpreter
 import (
 	"fmt"
 	"log"
+	"math"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 
+	"github.com/andyp1xe1/vidlang/language/commands"
 	"github.com/andyp1xe1/vidlang/language/parser"
 	ffmpeg "github.com/u2takey/ffmpeg-go"
 )
 
-type cmdHandler func(*Context, *Stream, []parser.NodeValue) (*Stream, bool, error)
+type cmdHandler func(*Context, *Stream, cmdArgs) (*Stream, bool, error)
 
 var handlerMap = map[string]cmdHandler{
 	// "open":       cmdOpen,
-	"export":     cmdExport,
-	"contrast":   cmdContrast,
-	"brightness": cmdBrightness,
-	"saturation": cmdSaturation,
-	"gamma":      cmdGamma,
-	"cut":        cmdTrim,
-	"concat":     cmdConcat,
-	"hue":        cmdHue,
-	"flip":       cmdFlip,
-	"stack":      cmdStack,
+	"export":       cmdExport,
+	"snapshot":     cmdSnapshot,
+	"contactsheet": cmdContactsheet,
+	"contrast":     cmdContrast,
+	"brightness":   cmdBrightness,
+	"saturation":   cmdSaturation,
+	"gamma":        cmdGamma,
+	"cut":          cmdTrim,
+	"concat":       cmdConcat,
+	"hue":          cmdHue,
+	"flip":         cmdFlip,
+	"crop":         cmdCrop,
+	"scale":        cmdScale,
+	"pad":          cmdPad,
+	"rotate":       cmdRotate,
+	"text":         cmdText,
+	"extractaudio": cmdExtractAudio,
+	"stack":        cmdStack,
 }
 
-func cmdTrim(ctx *Context, input *Stream, args []parser.NodeValue) (*Stream, bool, error) {
-	canCopy := false
-	if ctx.debug {
-		fmt.Printf("trim: %v\n", args)
-	}
+type directiveHandler func(*Context, cmdArgs) error
 
-	if len(args) != 2 {
-		return nil, canCopy, fmt.Errorf("command trim requires exactly 2 arguments (start and end)")
-	}
+var directiveMap = map[string]directiveHandler{
+	"canvas": cmdCanvas,
+}
 
-	start, err := getArg(ctx, args[0], ValueNumber)
-	if err != nil {
-		return nil, canCopy, fmt.Errorf("trim command requires a number for start time but: %v", err)
+// every registered command needs a handler, except open which starts a
+// pipeline and is evaluated by evaluatePipeline itself
+func init() {
+	for _, sig := range commands.All() {
+		if sig.Directive {
+			if _, ok := directiveMap[sig.Name]; !ok {
+				panic(fmt.Sprintf("interpreter: directive %s has no handler", sig.Name))
+			}
+			continue
+		}
+		if _, ok := handlerMap[sig.Name]; !ok && sig.Name != "open" {
+			panic(fmt.Sprintf("interpreter: command %s has no handler", sig.Name))
+		}
 	}
+}
 
-	end, err := getArg(ctx, args[1], ValueNumber)
-	if err != nil {
-		return nil, canCopy, fmt.Errorf("trim command requires a number for end time but: %v", err)
+func cmdTrim(ctx *Context, input *Stream, args cmdArgs) (*Stream, bool, error) {
+	canCopy := false
+	if ctx.debug {
+		fmt.Printf("trim: %v\n", args.values)
 	}
 
-	startVal := boxToPrimitive(start).(float64)
-	endVal := boxToPrimitive(end).(float64)
-
+	start, end := args.number("start"), args.number("end")
 	v := input.FFStream.Trim(ffmpeg.KwArgs{
-		"start": startVal,
-		"end":   endVal,
+		"start": start,
+		"end":   end,
 	}).Filter("setpts", ffmpeg.Args{"PTS-STARTPTS"}) //.Filter("fps", ffmpeg.Args{"30"})
 
-	return &Stream{FFStream: v}, canCopy, err
+	media := withMedia(input.Media, func(m *MediaInfo) {
+		if m.Duration > 0 {
+			m.Duration = math.Max(0, math.Min(end, m.Duration)-start)
+		}
+	})
+	return &Stream{FFStream: v, Media: media}, canCopy, nil
 }
 
-func cmdConcat(ctx *Context, input *Stream, args []parser.NodeValue) (*Stream, bool, error) {
+func cmdConcat(ctx *Context, input *Stream, args cmdArgs) (*Stream, bool, error) {
 	canCopy := false
 	if ctx.debug {
-		fmt.Printf("concat: %v\n", args)
-	}
-
-	if len(args) == 0 {
-		return nil, canCopy, fmt.Errorf("concat command requires at least one stream argument")
+		fmt.Printf("concat: %v\n", args.values)
 	}
 
 	// // Collect all streams to concatenate
 	// streams := []*ffmpeg.Stream{input.FFStream}
 
 	streams := make([]*ffmpeg.Stream, 0)
+	infos := make([]*MediaInfo, 0)
 
-	for _, arg := range args {
-		stream, _, err := getStreamArg(ctx, arg)
-		if err != nil {
-			return nil, canCopy, fmt.Errorf("concat argument must be a stream but: %v", err)
-		}
-
-		streamList := entryToList(stream)
+	for _, arg := range args.streams("streams") {
+		streamList := entryToList(arg.entry)
 		if len(streamList) != 1 {
 			return nil, canCopy, fmt.Errorf("concat currently only supports single streams per argument")
 		}
 
 		streams = append(streams, streamList[0].FFStream)
+		infos = append(infos, streamList[0].Media)
 	}
 
+	c := *ctx.canvas
 	normalizedStreams := make([]*ffmpeg.Stream, len(streams))
 	for i, stream := range streams {
 		// normalize everything: resolution, framerate, aspect ratio
 		normalizedStreams[i] = stream.
-			Filter("scale", ffmpeg.Args{"1920:1080:force_original_aspect_ratio=decrease"}).
-			Filter("pad", ffmpeg.Args{"1920:1080:(ow-iw)/2:(oh-ih)/2"}).
+			Filter("scale", ffmpeg.Args{fmt.Sprintf("%d:%d:force_original_aspect_ratio=decrease", c.Width, c.Height)}).
+			Filter("pad", ffmpeg.Args{fmt.Sprintf("%d:%d:(ow-iw)/2:(oh-ih)/2", c.Width, c.Height)}).
+			Filter("setsar", ffmpeg.Args{"1"}).
+			Filter("fps", ffmpeg.Args{fmt.Sprintf("%v", c.FPS)}).
+			Filter("format", ffmpeg.Args{c.PixFmt}).
 			Filter("setpts", ffmpeg.Args{"PTS-STARTPTS"})
 	}
 
 	concatStream := ffmpeg.Concat(normalizedStreams)
 
+	media := &MediaInfo{Width: c.Width, Height: c.Height, FPS: c.FPS, HasVideo: true}
+	if durations, ok := knownDurations(infos); ok {
+		for _, d := range durations {
+			media.Duration += d
+		}
+	}
+
 	return &Stream{
 		FFStream: concatStream,
+		Media:    media,
 	}, canCopy, nil
 }
 
-func cmdSaturation(ctx *Context, input *Stream, args []parser.NodeValue) (*Stream, bool, error) {
+func cmdSaturation(ctx *Context, input *Stream, args cmdArgs) (*Stream, bool, error) {
 	canCopy := false
 	if ctx.debug {
-		fmt.Printf("saturation: %v\n", args)
-	}
-	if len(args) != 1 {
-		return nil, canCopy, fmt.Errorf("command saturation requires exactly 1 argument")
-	}
-	saturation, err := getArg(ctx, args[0], ValueNumber)
-	if err != nil {
-		return nil, canCopy, fmt.Errorf(
-			"command saturation requires a number argument but: %v", err)
+		fmt.Printf("saturation: %v\n", args.values)
 	}
 
 	return &Stream{
 		FFStream: input.FFStream.Filter(
-			"eq", ffmpeg.Args{fmt.Sprintf("saturation=%v", boxToPrimitive(saturation))}),
+			"eq", ffmpeg.Args{fmt.Sprintf("saturation=%v", args.number("value"))}),
 	}, canCopy, nil
 }
 
-func cmdGamma(ctx *Context, input *Stream, args []parser.NodeValue) (*Stream, bool, error) {
+func cmdGamma(ctx *Context, input *Stream, args cmdArgs) (*Stream, bool, error) {
 	canCopy := false
 	if ctx.debug {
-		fmt.Printf("gamma: %v\n", args)
-	}
-	if len(args) != 1 {
-		return nil, canCopy, fmt.Errorf("command gamma requires exactly 1 argument")
-	}
-	gamma, err := getArg(ctx, args[0], ValueNumber)
-	if err != nil {
-		return nil, canCopy, fmt.Errorf(
-			"command gamma requires a number argument but: %v", err)
+		fmt.Printf("gamma: %v\n", args.values)
 	}
 
 	return &Stream{
 		FFStream: input.FFStream.Filter(
-			"eq", ffmpeg.Args{fmt.Sprintf("gamma=%v", boxToPrimitive(gamma))}),
+			"eq", ffmpeg.Args{fmt.Sprintf("gamma=%v", args.number("value"))}),
 	}, canCopy, nil
 }
 
-func cmdContrast(ctx *Context, input *Stream, args []parser.NodeValue) (*Stream, bool, error) {
+func cmdContrast(ctx *Context, input *Stream, args cmdArgs) (*Stream, bool, error) {
 	canCopy := false
 	if ctx.debug {
-		fmt.Printf("Contrast: %v\n", args)
-	}
-	if len(args) != 1 {
-		return nil, canCopy, fmt.Errorf("command contrast requires exactly 1 argument")
-	}
-	contrast, err := getArg(ctx, args[0], ValueNumber)
-	if err != nil {
-		return nil, canCopy, fmt.Errorf(
-			"command contrast requires a number argument but: %v", err)
+		fmt.Printf("Contrast: %v\n", args.values)
 	}
 
 	return &Stream{
 		FFStream: input.FFStream.Filter(
-			"eq", ffmpeg.Args{fmt.Sprintf("contrast=%v", boxToPrimitive(contrast))}),
+			"eq", ffmpeg.Args{fmt.Sprintf("contrast=%v", args.number("value"))}),
 	}, canCopy, nil
 }
 
-func cmdBrightness(ctx *Context, input *Stream, args []parser.NodeValue) (*Stream, bool, error) {
+func cmdBrightness(ctx *Context, input *Stream, args cmdArgs) (*Stream, bool, error) {
 	canCopy := false
 	if ctx.debug {
-		fmt.Printf("Brightness: %v\n", args)
-	}
-	if len(args) != 1 {
-		return nil, canCopy, fmt.Errorf("command brightness requires exactly 1 argument")
-	}
-	brightness, err := getArg(ctx, args[0], ValueNumber)
-	if err != nil {
-		return nil, canCopy, fmt.Errorf(
-			"command brightness requires a number argument but: %v", err)
+		fmt.Printf("Brightness: %v\n", args.values)
 	}
 
 	return &Stream{
 		FFStream: input.FFStream.Filter(
-			"eq", ffmpeg.Args{fmt.Sprintf("brightness=%v", boxToPrimitive(brightness))}),
+			"eq", ffmpeg.Args{fmt.Sprintf("brightness=%v", args.number("value"))}),
 	}, canCopy, nil
 }
 
-func cmdHue(ctx *Context, input *Stream, args []parser.NodeValue) (*Stream, bool, error) {
+func cmdHue(ctx *Context, input *Stream, args cmdArgs) (*Stream, bool, error) {
 	canCopy := false
 	if ctx.debug {
-		fmt.Printf("hue: %v\n", args)
-	}
-	if len(args) != 1 {
-		return nil, canCopy, fmt.Errorf("command hue requires exactly 1 argument")
-	}
-	hue, err := getArg(ctx, args[0], ValueNumber)
-	if err != nil {
-		return nil, canCopy, fmt.Errorf(
-			"command hue requires a number argument but: %v", err)
+		fmt.Printf("hue: %v\n", args.values)
 	}
 
 	return &Stream{
-		FFStream: input.FFStream.Hue(ffmpeg.KwArgs{"h": boxToPrimitive(hue)}),
+		FFStream: input.FFStream.Hue(ffmpeg.KwArgs{"h": args.number("degrees")}),
 	}, canCopy, nil
 }
 
-func cmdFlip(ctx *Context, input *Stream, args []parser.NodeValue) (*Stream, bool, error) {
+func cmdCrop(ctx *Context, input *Stream, args cmdArgs) (*Stream, bool, error) {
 	canCopy := false
 	if ctx.debug {
-		fmt.Printf("flip: %v\n", args)
+		fmt.Printf("crop: %v\n", args.values)
 	}
-	if len(args) != 1 {
-		return nil, canCopy, fmt.Errorf("command flip  exactly 1 argument")
+
+	w, h, x, y := args.number("width"), args.number("height"), args.number("x"), args.number("y")
+	for _, p := range []struct {
+		name     string
+		v, least float64
+	}{{"width", w, 1}, {"height", h, 1}, {"x", x, -1}, {"y", y, -1}} {
+		if err := wholeNumber(p.name, p.v, p.least); err != nil {
+			return nil, canCopy, err
+		}
 	}
-	flip, err := getArg(ctx, args[0], ValueString)
-	if err != nil {
-		return nil, canCopy, fmt.Errorf(
-			"command flip requires a string argument but: %v", err)
+	if m := input.Media; m != nil && m.Width > 0 && m.Height > 0 {
+		if int(w+max(x, 0)) > m.Width || int(h+max(y, 0)) > m.Height {
+			return nil, canCopy, fmt.Errorf("crop of %vx%v at %v,%v does not fit in the %dx%d frame", w, h, max(x, 0), max(y, 0), m.Width, m.Height)
+		}
 	}
 
-	if strings.Compare(boxToPrimitive(flip).(string), "h") != 0 && strings.Compare(boxToPrimitive(flip).(string), "v") != 0 {
-		return nil, false, fmt.Errorf("command requires either `h` or `v` as arguments")
+	// -1 centers the rectangle
+	xs, ys := fmt.Sprintf("%v", x), fmt.Sprintf("%v", y)
+	if x < 0 {
+		xs = "(iw-ow)/2"
+	}
+	if y < 0 {
+		ys = "(ih-oh)/2"
 	}
+	v := input.FFStream.Filter("crop", ffmpeg.Args{fmt.Sprintf("%v", w), fmt.Sprintf("%v", h), xs, ys})
 
-	if strings.Compare(boxToPrimitive(flip).(string), "h") == 0 {
-		return &Stream{
-			FFStream: input.FFStream.VFlip(),
-		}, canCopy, nil
-	} else {
-		return &Stream{
-			FFStream: input.FFStream.HFlip(),
-		}, canCopy, nil
+	media := withMedia(input.Media, func(m *MediaInfo) {
+		m.Width, m.Height = int(w), int(h)
+	})
+	return &Stream{FFStream: v, Media: media}, canCopy, nil
+}
+
+func cmdScale(ctx *Context, input *Stream, args cmdArgs) (*Stream, bool, error) {
+	canCopy := false
+	if ctx.debug {
+		fmt.Printf("scale: %v\n", args.values)
+	}
+
+	w, h, mode := args.number("width"), args.number("height"), args.string("mode")
+	for _, p := range []struct {
+		name string
+		v    float64
+	}{{"width", w}, {"height", h}} {
+		if p.v != -1 {
+			if err := wholeNumber(p.name, p.v, 1); err != nil {
+				return nil, canCopy, fmt.Errorf("%v, or -1 to follow the aspect ratio", err)
+			}
+		}
+	}
+	if w == -1 && h == -1 {
+		return nil, canCopy, fmt.Errorf("only one of width and height can follow the aspect ratio")
 	}
+	if mode != "stretch" && (w == -1 || h == -1) {
+		return nil, canCopy, fmt.Errorf("%s needs both width and height", mode)
+	}
+
+	size := func(v float64) string {
+		if v == -1 {
+			// -2 keeps the size even, which encoders need
+			return "-2"
+		}
+		return fmt.Sprintf("%v", v)
+	}
+	var v *ffmpeg.Stream
+	switch mode {
+	case "fit":
+		v = input.FFStream.Filter("scale", ffmpeg.Args{size(w), size(h), "force_original_aspect_ratio=decrease", "force_divisible_by=2"})
+	case "fill":
+		v = input.FFStream.
+			Filter("scale", ffmpeg.Args{size(w), size(h), "force_original_aspect_ratio=increase"}).
+			Filter("crop", ffmpeg.Args{size(w), size(h)})
+	default:
+		v = input.FFStream.Filter("scale", ffmpeg.Args{size(w), size(h)})
+	}
+
+	media := withMedia(input.Media, func(m *MediaInfo) {
+		known := m.Width > 0 && m.Height > 0
+		switch {
+		case mode == "fit" && known:
+			f := math.Min(w/float64(m.Width), h/float64(m.Height))
+			m.Width, m.Height = evenRound(float64(m.Width)*f), evenRound(float64(m.Height)*f)
+		case mode == "fit":
+			m.Width, m.Height = 0, 0
+		case w == -1 && known:
+			m.Width, m.Height = evenRound(h*float64(m.Width)/float64(m.Height)), int(h)
+		case h == -1 && known:
+			m.Width, m.Height = int(w), evenRound(w*float64(m.Height)/float64(m.Width))
+		case w == -1 || h == -1:
+			m.Width, m.Height = 0, 0
+		default:
+			m.Width, m.Height = int(w), int(h)
+		}
+	})
+	return &Stream{FFStream: v, Media: media}, canCopy, nil
 }
 
-func cmdStack(ctx *Context, input *Stream, args []parser.NodeValue) (*Stream, bool, error) {
+var colorPattern = regexp.MustCompile(`^([a-zA-Z]+|#[0-9a-fA-F]{6}([0-9a-fA-F]{2})?)(@(0|1|0?\.[0-9]+))?$`)
+
+func cmdPad(ctx *Context, input *Stream, args cmdArgs) (*Stream, bool, error) {
 	canCopy := false
 	if ctx.debug {
-		fmt.Printf("stack: %v\n", args)
+		fmt.Printf("pad: %v\n", args.values)
 	}
 
-	if len(args) < 2 {
-		return nil, canCopy, fmt.Errorf("stack command requires at least 2 arguments (direction and 1+ streams)")
+	w, h, color := args.number("width"), args.number("height"), args.string("color")
+	if err := wholeNumber("width", w, 1); err != nil {
+		return nil, canCopy, err
+	}
+	if err := wholeNumber("height", h, 1); err != nil {
+		return nil, canCopy, err
+	}
+	if !colorPattern.MatchString(color) {
+		return nil, canCopy, fmt.Errorf("color must be a name or #rrggbb, optionally with @alpha, got %q", color)
+	}
+	if m := input.Media; m != nil && (int(w) < m.Width || int(h) < m.Height) {
+		return nil, canCopy, fmt.Errorf("pad to %vx%v is smaller than the %dx%d frame", w, h, m.Width, m.Height)
 	}
 
-	// Get direction argument (first arg)
-	direction, err := getArg(ctx, args[0], ValueString)
+	v := input.FFStream.Filter("pad", ffmpeg.Args{
+		fmt.Sprintf("%v", w), fmt.Sprintf("%v", h), "(ow-iw)/2", "(oh-ih)/2", color,
+	})
+
+	media := withMedia(input.Media, func(m *MediaInfo) {
+		m.Width, m.Height = int(w), int(h)
+	})
+	return &Stream{FFStream: v, Media: media}, canCopy, nil
+}
+
+func cmdRotate(ctx *Context, input *Stream, args cmdArgs) (*Stream, bool, error) {
+	canCopy := false
+	if ctx.debug {
+		fmt.Printf("rotate: %v\n", args.values)
+	}
+
+	degrees := math.Mod(args.number("degrees"), 360)
+	if degrees < 0 {
+		degrees += 360
+	}
+
+	var v *ffmpeg.Stream
+	swap := false
+	switch degrees {
+	case 0:
+		v = input.FFStream
+	case 90:
+		v, swap = input.FFStream.Filter("transpose", ffmpeg.Args{"clock"}), true
+	case 180:
+		v = input.FFStream.HFlip().VFlip()
+	case 270:
+		v, swap = input.FFStream.Filter("transpose", ffmpeg.Args{"cclock"}), true
+	default:
+		// the frame grows to hold the turned corners, kept even for encoders
+		a := degrees * math.Pi / 180
+		v = input.FFStream.Filter("rotate", ffmpeg.Args{
+			fmt.Sprintf("%v", a),
+			fmt.Sprintf("ow=ceil(rotw(%v)/2)*2", a),
+			fmt.Sprintf("oh=ceil(roth(%v)/2)*2", a),
+			"c=black",
+		})
+	}
+
+	media := withMedia(input.Media, func(m *MediaInfo) {
+		switch {
+		case swap:
+			m.Width, m.Height = m.Height, m.Width
+		case degrees != 0 && degrees != 180:
+			a := degrees * math.Pi / 180
+			w, h := float64(m.Width), float64(m.Height)
+			sin, cos := math.Abs(math.Sin(a)), math.Abs(math.Cos(a))
+			m.Width = int(math.Ceil((w*cos+h*sin)/2)) * 2
+			m.Height = int(math.Ceil((w*sin+h*cos)/2)) * 2
+		}
+	})
+	return &Stream{FFStream: v, Media: media}, canCopy, nil
+}
+
+func cmdText(ctx *Context, input *Stream, args cmdArgs) (*Stream, bool, error) {
+	canCopy := false
+	if ctx.debug {
+		fmt.Printf("text: %v\n", args.values)
+	}
+
+	x, err := textPosition("x", args.value("x"), map[string]string{
+		"left": "w*0.05", "center": "(w-tw)/2", "right": "w-tw-w*0.05",
+	})
+	if err != nil {
+		return nil, canCopy, err
+	}
+	y, err := textPosition("y", args.value("y"), map[string]string{
+		"top": "h*0.05", "center": "(h-th)/2", "bottom": "h-th-h*0.05",
+	})
 	if err != nil {
-		return nil, canCopy, fmt.Errorf("stack command requires a string for direction but: %v", err)
+		return nil, canCopy, err
+	}
+	size := args.number("size")
+	if size <= 0 {
+		return nil, canCopy, fmt.Errorf("size must be positive, got %v", size)
+	}
+	for _, name := range []string{"color", "boxcolor"} {
+		if !colorPattern.MatchString(args.string(name)) {
+			return nil, canCopy, fmt.Errorf("%s must be a name or #rrggbb, optionally with @alpha, got %q", name, args.string(name))
+		}
 	}
 
-	directionStr := boxToPrimitive(direction).(string)
-	if directionStr != "h" && directionStr != "v" {
-		return nil, canCopy, fmt.Errorf("stack direction must be 'h' (horizontal) or 'v' (vertical)")
+	opts := ffmpeg.Args{
+		"text=" + escapeFilterValue(args.string("text")),
+		"expansion=none",
+		"x=" + x,
+		"y=" + y,
+		fmt.Sprintf("fontsize=%v", size),
+		"fontcolor=" + args.string("color"),
+	}
+	if font := args.string("font"); font != "" {
+		path := ctx.resolvePath(font)
+		if _, err := os.Stat(path); err != nil {
+			return nil, canCopy, fmt.Errorf("font not found: %s", path)
+		}
+		opts = append(opts, "fontfile="+escapeFilterValue(path))
+	}
+	if args.bool("box") {
+		opts = append(opts, "box=1", "boxcolor="+args.string("boxcolor"), fmt.Sprintf("boxborderw=%v", math.Round(size/4)))
+	}
+
+	from, to := args.number("from"), args.number("to")
+	switch {
+	case from >= 0 && to >= 0 && to <= from:
+		return nil, canCopy, fmt.Errorf("to must come after from, got %v and %v", from, to)
+	case from >= 0 && to >= 0:
+		opts = append(opts, fmt.Sprintf("enable=between(t,%v,%v)", from, to))
+	case from >= 0:
+		opts = append(opts, fmt.Sprintf("enable=gte(t,%v)", from))
+	case to >= 0:
+		opts = append(opts, fmt.Sprintf("enable=lte(t,%v)", to))
+	}
+
+	return &Stream{
+		FFStream: input.FFStream.Filter("drawtext", opts),
+		Media:    input.Media,
+	}, canCopy, nil
+}
+
+// textPosition turns a position argument of text, pixels or a keyword,
+// into a drawtext expression
+func textPosition(name string, v any, keywords map[string]string) (string, error) {
+	switch v := v.(type) {
+	case float64:
+		return fmt.Sprintf("%v", v), nil
+	case string:
+		if expr, ok := keywords[v]; ok {
+			return expr, nil
+		}
+	}
+	names := make([]string, 0, len(keywords))
+	for k := range keywords {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return "", fmt.Errorf("%s must be a number of pixels or one of %s, got %v", name, strings.Join(names, ", "), v)
+}
+
+// escapeFilterValue escapes a filter option value so it is read as is.
+// Only the option level is escaped here, ffmpeg-go escapes the graph.
+func escapeFilterValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`, `:`, `\:`).Replace(s)
+}
+
+// wholeNumber checks a size or position argument
+func wholeNumber(name string, v, least float64) error {
+	if v < least || v != math.Trunc(v) {
+		return fmt.Errorf("%s must be a whole number of at least %v, got %v", name, least, v)
+	}
+	return nil
+}
+
+func cmdExtractAudio(ctx *Context, input *Stream, _ cmdArgs) (*Stream, bool, error) {
+	canCopy := false
+	if input.Media != nil && !input.Media.HasAudio {
+		return nil, canCopy, fmt.Errorf("the clip has no audio")
+	}
+	// filters only carry the video, the audio is only there on inputs
+	if input.Edited {
+		return nil, canCopy, fmt.Errorf("extractaudio takes clips straight from open, edits keep only the video")
+	}
+
+	media := &MediaInfo{HasAudio: true}
+	if input.Media != nil {
+		media.Duration = input.Media.Duration
+		media.Created = input.Media.Created
+	}
+	return &Stream{FFStream: input.FFStream.Audio(), Media: media}, canCopy, nil
+}
+
+func cmdFlip(ctx *Context, input *Stream, args cmdArgs) (*Stream, bool, error) {
+	canCopy := false
+	if ctx.debug {
+		fmt.Printf("flip: %v\n", args.values)
+	}
+
+	switch args.string("direction") {
+	case "h":
+		return &Stream{FFStream: input.FFStream.HFlip(), Media: input.Media}, canCopy, nil
+	case "v":
+		return &Stream{FFStream: input.FFStream.VFlip(), Media: input.Media}, canCopy, nil
+	case "both":
+		return &Stream{FFStream: input.FFStream.HFlip().VFlip(), Media: input.Media}, canCopy, nil
+	case "mirror":
+		// the frame next to its reflection, from two branches of a split
+		split := input.FFStream.Split()
+		mirrored := ffmpeg.Filter([]*ffmpeg.Stream{split.Get("0"), split.Get("1").HFlip()}, "hstack", ffmpeg.Args{"inputs=2"})
+		media := withMedia(input.Media, func(m *MediaInfo) {
+			m.Width *= 2
+		})
+		return &Stream{FFStream: mirrored, Media: media}, canCopy, nil
+	}
+	return nil, canCopy, fmt.Errorf("unknown flip direction %q", args.string("direction"))
+}
+
+func cmdStack(ctx *Context, input *Stream, args cmdArgs) (*Stream, bool, error) {
+	canCopy := false
+	if ctx.debug {
+		fmt.Printf("stack: %v\n", args.values)
 	}
 
+	directionStr := args.string("direction")
+
 	// Collect all streams to stack (starting from second arg)
 	streams := make([]*ffmpeg.Stream, 0)
 
 	// Add the input stream first
 	streams = append(streams, input.FFStream)
+	infos := []*MediaInfo{input.Media}
 
 	// Add all the streams from arguments
-	for i := 1; i < len(args); i++ {
-		stream, _, err := getStreamArg(ctx, args[i])
-		if err != nil {
-			return nil, canCopy, fmt.Errorf("stack argument %d must be a stream but: %v", i+1, err)
-		}
-
-		streamList := entryToList(stream)
+	for _, arg := range args.streams("streams") {
+		streamList := entryToList(arg.entry)
 		if len(streamList) != 1 {
 			return nil, canCopy, fmt.Errorf("stack currently only supports single streams per argument")
 		}
 
 		streams = append(streams, streamList[0].FFStream)
+		infos = append(infos, streamList[0].Media)
 	}
 
 	// Normalize all streams to same dimensions to avoid squashing
 	normalizedStreams := make([]*ffmpeg.Stream, len(streams))
+	c := *ctx.canvas
 
 	if directionStr == "h" {
-		// For horizontal stacking, normalize to same height (1080p), keep aspect ratio
+		// For horizontal stacking, normalize to the canvas height, keep aspect ratio
 		for i, stream := range streams {
 			normalizedStreams[i] = stream.
-				Filter("scale", ffmpeg.Args{"-1:1080:force_original_aspect_ratio=decrease"}).
-				Filter("pad", ffmpeg.Args{"iw:1080:(iw-ow)/2:(ih-oh)/2"}).
+				Filter("scale", ffmpeg.Args{fmt.Sprintf("-2:%d:force_original_aspect_ratio=decrease", c.Height)}).
+				Filter("pad", ffmpeg.Args{fmt.Sprintf("iw:%d:(iw-ow)/2:(ih-oh)/2", c.Height)}).
 				Filter("setsar", ffmpeg.Args{"1:1"})
 		}
 	} else {
-		// For vertical stacking, normalize to same width (1920px), keep aspect ratio
+		// For vertical stacking, normalize to the canvas width, keep aspect ratio
 		for i, stream := range streams {
 			normalizedStreams[i] = stream.
-				Filter("scale", ffmpeg.Args{"1920:-1:force_original_aspect_ratio=decrease"}).
-				Filter("pad", ffmpeg.Args{"1920:ih:(iw-ow)/2:(ih-oh)/2"}).
+				Filter("scale", ffmpeg.Args{fmt.Sprintf("%d:-2:force_original_aspect_ratio=decrease", c.Width)}).
+				Filter("pad", ffmpeg.Args{fmt.Sprintf("%d:ih:(iw-ow)/2:(ih-oh)/2", c.Width)}).
 				Filter("setsar", ffmpeg.Args{"1:1"})
 		}
 	}
@@ -305,37 +572,71 @@ func cmdStack(ctx *Context, input *Stream, args []parser.NodeValue) (*Stream, bo
 
 	return &Stream{
 		FFStream: stackedStream,
+		Media:    stackedMedia(infos, directionStr, c),
 	}, canCopy, nil
 }
 
 // cmdOpen implements the 'open' command, not a handler
-func cmdOpen(ctx *Context, args []parser.NodeValue) ([]*Stream, error) {
-
-	if len(args) != 1 {
-		return nil, fmt.Errorf("open command requires exactly one argument")
+func cmdOpen(ctx *Context, args cmdArgs) ([]*Stream, error) {
+	path := ctx.resolvePath(args.string("path"))
+	exts, err := extensionSet(args.string("ext"))
+	if err != nil {
+		return nil, err
 	}
+	sortBy := args.string("sort")
 
-	var path string
+	fps := args.number("fps")
+	if isFramePattern(path) || isImageGlob(path) {
+		if sortBy != "name" {
+			return nil, fmt.Errorf("image sequences are read in name order")
+		}
+		if fps == 0 {
+			fps = ctx.canvas.FPS
+		}
+		if fps < 0 {
+			return nil, fmt.Errorf("fps must be positive, got %v", fps)
+		}
+		stream, err := openSequence(path, fps)
+		if err != nil {
+			return nil, err
+		}
+		return []*Stream{stream}, nil
+	}
+	if fps != 0 {
+		return nil, fmt.Errorf("fps only applies to image sequences")
+	}
 
-	if val, err := getArg(ctx, args[0], ValueString); err != nil {
-		return nil, fmt.Errorf("open command requires a string argument but: %v", err)
-	} else {
-		path = boxToPrimitive(val).(string)
+	if isGlob(path) {
+		files, err := globFiles(path)
+		if err != nil {
+			return nil, err
+		}
+		streams, err := openFiles(ctx, files, exts, sortBy)
+		if err != nil {
+			return nil, err
+		}
+		if len(streams) == 0 {
+			return nil, fmt.Errorf("no media files match %s", path)
+		}
+		return streams, nil
 	}
 
 	fileInfo, err := os.Stat(path)
 	if os.IsNotExist(err) {
 		return nil, fmt.Errorf("path not found: %s", path)
+	} else if err != nil {
+		return nil, err
 	}
 
 	if fileInfo.IsDir() {
-		return openDirectory(ctx, path)
+		return openDirectory(ctx, path, exts, sortBy)
 	}
 
-	ffStream := ffmpeg.Input(path)
-
+	media, _ := probeFile(path)
 	stream := &Stream{
-		FFStream: ffStream,
+		FFStream: ffmpeg.Input(path),
+		Origin:   &Origin{Path: path, ModTime: fileInfo.ModTime()},
+		Media:    media,
 	}
 
 	if ctx.debug {
@@ -345,42 +646,19 @@ func cmdOpen(ctx *Context, args []parser.NodeValue) ([]*Stream, error) {
 	return []*Stream{stream}, nil
 }
 
-func openDirectory(ctx *Context, dirPath string) ([]*Stream, error) {
-	files, err := os.ReadDir(dirPath)
+func openDirectory(ctx *Context, dirPath string, exts map[string]bool, sortBy string) ([]*Stream, error) {
+	files, err := dirFiles(dirPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read directory: %v", err)
+		return nil, err
 	}
 
-	streams := make([]*Stream, 0)
-
-	// Scan for video files
-	for _, file := range files {
-		if file.IsDir() {
-			continue // Skip subdirectories
-		}
-
-		filename := file.Name()
-		ext := strings.ToLower(getFileExtension(filename))
-
-		// Check if it's a video file
-		if ext == ".mp4" || ext == ".mkv" {
-			fullPath := fmt.Sprintf("%s/%s", dirPath, filename)
-
-			ffStream := ffmpeg.Input(fullPath)
-			stream := &Stream{
-				FFStream: ffStream,
-			}
-
-			streams = append(streams, stream)
-
-			if ctx.debug {
-				fmt.Printf("Opened file from directory: %s\n", fullPath)
-			}
-		}
+	streams, err := openFiles(ctx, files, exts, sortBy)
+	if err != nil {
+		return nil, err
 	}
 
 	if len(streams) == 0 {
-		return nil, fmt.Errorf("no video files found in directory: %s", dirPath)
+		return nil, fmt.Errorf("no media files found in directory: %s", dirPath)
 	}
 
 	return streams, nil
@@ -395,130 +673,267 @@ func getFileExtension(filename string) string {
 }
 
 // cmdExport implements the 'export' command
-func cmdExport(env *Context, _ *Stream, args []parser.NodeValue) (*Stream, bool, error) {
+func cmdExport(env *Context, _ *Stream, args cmdArgs) (*Stream, bool, error) {
 
 	if env.debug {
 		log.Println("exporting")
 	}
 
-	if len(args) != 2 {
-		return nil, false, fmt.Errorf("export command requires exactly two arguments")
-	}
-
-	var outputFile string
-	var inputStream interface{}
-	var canCopy bool
 	var err error
+	input := args.stream("stream")
+	canCopy := input.canCopy
+	outputFile := env.resolvePath(args.string("path"))
 
-	// Get the stream argument
-	if inputStream, canCopy, err = getStreamArg(env, args[0]); err != nil {
-		return nil, canCopy, fmt.Errorf(
-			"export command requires as first argument a stream but: %v", err)
+	streams := entryToList(input.entry)
+	if len(streams) == 0 {
+		return nil, false, fmt.Errorf("no streams to export")
 	}
 
-	// Get the output filename
-	if val, err := getArg(env, args[1], ValueString); err != nil {
-		return nil, canCopy, fmt.Errorf(
-			"export command requires as second argument a string but: %v", err)
-	} else {
-		outputFile = boxToPrimitive(val).(string)
+	paths, err := outputPaths(outputFile, streams)
+	if err != nil {
+		return nil, false, err
 	}
 
-	streams := entryToList(inputStream)
-	if len(streams) == 0 {
-		return nil, false, fmt.Errorf("no streams to export")
+	preset, err := env.preset(args.string("preset"))
+	if err != nil {
+		return nil, false, err
 	}
 
-	// If multiple streams, append index to filename
+	canvas := env.canvas.with(preset.Canvas).with(canvasArgs(args))
+	if err := canvas.validate(); err != nil {
+		return nil, false, err
+	}
+
+	enc := preset.encoding().with(encodingArgs(args))
+
 	var lastStream *Stream
 	for i, stream := range streams {
 		lastStream = stream
-		currentOutput := outputFile
-		if len(streams) > 1 {
-			ext := getFileExtension(outputFile)
-			base := outputFile[:len(outputFile)-len(ext)]
-			currentOutput = fmt.Sprintf("%s_%d%s", base, i, ext)
+		if err := exportStream(env, stream, paths[i], canCopy, canvas, enc, args); err != nil {
+			return nil, canCopy, err
 		}
+	}
 
-		ffargs := make(ffmpeg.KwArgs)
-		ffStreamArgs := make(ffmpeg.KwArgs)
+	return lastStream, canCopy, nil
+}
 
-		if !canCopy {
-			ffargs["c:v"] = "libx264"
-			ffargs["c:a"] = "aac"
-		} else if !env.preview {
-			ffargs["c"] = "copy"
-			ffStreamArgs["c"] = "copy"
-		}
+// exportStream writes a single stream of an export to path, removing the
+// two-pass log once it is done
+func exportStream(env *Context, stream *Stream, path string, canCopy bool, canvas Canvas, enc encoding, args cmdArgs) error {
+	if err := makeOutputDir(path); err != nil {
+		return err
+	}
 
-		ffStreamArgs["tune"] = "zerolatency"
-		ffStreamArgs["preset"] = "ultrafast"
-		ffStreamArgs["f"] = "mpegts"
-		ffStreamArgs["r"] = "24"
-		//ffStreamArgs["s"] = "1280x720"
+	ffargs := make(ffmpeg.KwArgs)
+	ffStreamArgs := make(ffmpeg.KwArgs)
 
-		ffargs["r"] = "30"
-		ffargs["s"] = "1920x1080"
-		ffargs["fflags"] = "+genpts"
-		ffargs["y"] = ""
+	resolved, err := enc.resolve(path)
+	if err != nil {
+		return err
+	}
+
+	sequence := stream.Origin != nil && stream.Origin.Sequence
+	copyAll := canCopy && !enc.isSet() && resolved.copyable() && !sequence
+	if copyAll && !env.preview {
+		ffargs["c"] = "copy"
+		ffStreamArgs["c"] = "copy"
+	}
 
-		var outputs []*ffmpeg.Stream = make([]*ffmpeg.Stream, 0)
-		if env.preview {
+	ffStreamArgs["tune"] = "zerolatency"
+	ffStreamArgs["preset"] = "ultrafast"
+	ffStreamArgs["f"] = "mpegts"
+	ffStreamArgs["r"] = fmt.Sprintf("%v", canvas.FPS)
+	//ffStreamArgs["s"] = "1280x720"
 
-			if err := env.StartPreviewPlayer(); err != nil {
-				log.Printf("Warning: Failed to start preview player: %v", err)
+	if !copyAll {
+		if !canCopy && (resolved.vcodec == "copy" || resolved.acodec == "copy") {
+			return fmt.Errorf("can't copy a stream that was edited, it has to be encoded")
+		}
+		if resolved.size != "" {
+			info, _ := mediaInfo(stream)
+			resolved.bitrate, resolved.abitrate, err = resolved.sizeBitrate(info)
+			if err != nil {
+				return err
 			}
+		}
+		resolved.apply(ffargs, canvas)
+	}
+	if ffargs["c:v"] != "copy" && !resolved.audioOnly() {
+		ffargs["r"] = fmt.Sprintf("%v", canvas.FPS)
+		if !resolved.animated() {
+			ffargs["s"] = canvas.size()
+		}
+	}
+	// encoded builds the graph the output is written from
+	encoded := func(in *ffmpeg.Stream) *ffmpeg.Stream {
+		if resolved.animated() {
+			return resolved.animatedGraph(in, canvas, canvasArgs(args).Height)
+		}
+		return in
+	}
+	ffargs["fflags"] = "+genpts"
+	ffargs["y"] = ""
 
-			split := stream.FFStream.Split()
-			outputStream := split.Get("0").Output(currentOutput, ffargs)
-			udpStream := split.Get("1").Output("udp://127.0.0.1:1234", ffStreamArgs)
-			outputs = append(outputs, outputStream, udpStream)
-		} else {
-			out := stream.FFStream.Output(currentOutput, ffargs)
-			outputs = append(outputs, out)
+	if enc.size != "" {
+		passDir, err := os.MkdirTemp("", "vidlang-pass")
+		if err != nil {
+			return err
 		}
+		defer os.RemoveAll(passDir)
+		passlog := filepath.Join(passDir, "pass")
+		if err := firstPass(stream.FFStream, ffargs, passlog); err != nil {
+			return err
+		}
+		ffargs["pass"] = "2"
+		ffargs["passlogfile"] = passlog
+	}
 
-		final := ffmpeg.MergeOutputs(outputs...)
+	var outputs []*ffmpeg.Stream = make([]*ffmpeg.Stream, 0)
+	if env.preview {
 
-		var errBuf strings.Builder
-		err = final.ErrorToStdOut().WithErrorOutput(&errBuf).Run()
-		if err != nil {
-			ffmpegOutput := errBuf.String()
-			return nil, canCopy, fmt.Errorf("export failed: %w\nFFmpeg output:\n%s", err, ffmpegOutput)
+		if err := env.StartPreviewPlayer(); err != nil {
+			log.Printf("Warning: Failed to start preview player: %v", err)
 		}
 
-		if env.debug {
-			fmt.Printf("Export completed successfully: %s\n", currentOutput)
+		split := stream.FFStream.Split()
+		outputStream := encoded(split.Get("0")).Output(path, ffargs)
+		udpStream := split.Get("1").Output("udp://127.0.0.1:1234", ffStreamArgs)
+		outputs = append(outputs, outputStream, udpStream)
+	} else {
+		out := encoded(stream.FFStream).Output(path, ffargs)
+		outputs = append(outputs, out)
+	}
+
+	final := ffmpeg.MergeOutputs(outputs...)
+
+	if err := runOutput(final); err != nil {
+		return err
+	}
+	if enc.size != "" {
+		if err := checkSize(path, enc.size); err != nil {
+			return err
 		}
 	}
 
-	return lastStream, canCopy, nil
+	if env.debug {
+		fmt.Printf("Export completed successfully: %s\n", path)
+	}
+	return nil
 }
 
 func getStreamArg(env *Context, arg parser.NodeValue) (interface{}, bool, error) {
-	if arg.ValueType() == parser.ValueIdentifier {
-		return env.streams.getAuto(arg.(parser.NodeIdent))
+	arg, err := resolveCond(env, arg)
+	if err != nil {
+		return nil, false, err
+	}
+	if ident, ok := parser.VarName(arg); ok {
+		return env.getStream(ident)
+	}
+	if index, ok := arg.(parser.NodeIndex); ok {
+		box, err := evalIndex(env, index)
+		if err != nil {
+			return nil, false, err
+		}
+		if box.typ != ValueStream {
+			return nil, false, fmt.Errorf("%s is a %v", arg, box.typ)
+		}
+		s := box.any.(streamArg)
+		return s.entry, s.canCopy, nil
 	}
 	// log.Println("Type: ", arg.ValueType())
 	return nil, false, fmt.Errorf("expected an identifier but got %s", arg)
 }
 
 func getArg(env *Context, arg parser.NodeValue, expectType valueType) (ValueBox, error) {
-	switch v := arg.(type) {
-	case parser.NodeIdent:
-		val, err := env.getVar(v)
+	box, err := evalValue(env, arg)
+	if err != nil {
+		return ValueBox{}, err
+	}
+	if box.typ != expectType {
+		return ValueBox{}, fmt.Errorf("expected type %v but got %v", expectType, box.typ)
+	}
+	return box, nil
+}
+
+func cmdSnapshot(env *Context, _ *Stream, args cmdArgs) (*Stream, bool, error) {
+	input := args.stream("stream")
+	t := args.number("time")
+	if t < 0 {
+		return nil, false, fmt.Errorf("time must not be negative, got %v", t)
+	}
+
+	streams := entryToList(input.entry)
+	paths, err := outputPaths(env.resolvePath(args.string("path")), streams)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var lastStream *Stream
+	for i, stream := range streams {
+		lastStream = stream
+		if info := stream.Media; info != nil && info.Duration != 0 && t >= info.Duration {
+			return nil, false, fmt.Errorf("time %v is past the end of the clip at %v", t, info.Duration)
+		}
+		kw, err := imageArgs(paths[i])
 		if err != nil {
-			return ValueBox{}, err
+			return nil, false, err
+		}
+		// unedited files seek on the input, which skips decoding up to t
+		frame := stream.FFStream
+		if input.canCopy && stream.Origin != nil && !stream.Origin.Sequence {
+			frame = ffmpeg.Input(stream.Origin.Path, ffmpeg.KwArgs{"ss": fmt.Sprintf("%v", t)})
+		} else {
+			kw["ss"] = fmt.Sprintf("%v", t)
 		}
-		if val.typ != expectType {
-			return ValueBox{}, fmt.Errorf("expected type %v but got %v", expectType, val.typ)
+		if err := writeImage(frame, paths[i], kw); err != nil {
+			return nil, false, err
 		}
-		return val, nil
-	default:
-		box := literalToBox(v)
-		if box.typ != expectType {
-			return ValueBox{}, fmt.Errorf("expected type %v but got %v", expectType, box.typ)
+	}
+	return lastStream, input.canCopy, nil
+}
+
+func cmdContactsheet(env *Context, _ *Stream, args cmdArgs) (*Stream, bool, error) {
+	input := args.stream("stream")
+	cols, rows := args.number("cols"), args.number("rows")
+	for _, n := range []float64{cols, rows} {
+		if n < 1 || n != math.Trunc(n) {
+			return nil, false, fmt.Errorf("cols and rows must be whole numbers of at least 1, got %v", n)
+		}
+	}
+	width := int(args.number("width"))
+	if width == 0 {
+		width = env.canvas.Width
+	}
+	tileWidth := evenRound(float64(width) / cols)
+	if tileWidth < 2 {
+		return nil, false, fmt.Errorf("a sheet %d wide has no room for %v columns", width, cols)
+	}
+
+	streams := entryToList(input.entry)
+	paths, err := outputPaths(env.resolvePath(args.string("path")), streams)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var lastStream *Stream
+	for i, stream := range streams {
+		lastStream = stream
+		if stream.Media == nil || stream.Media.Duration == 0 {
+			return nil, false, fmt.Errorf("contactsheet needs the duration of the clip, which is unknown")
+		}
+		kw, err := imageArgs(paths[i])
+		if err != nil {
+			return nil, false, err
+		}
+		interval := stream.Media.Duration / (cols * rows)
+		sheet := stream.FFStream.
+			Filter("select", ffmpeg.Args{fmt.Sprintf("isnan(prev_selected_t)+gte(t-prev_selected_t,%v)", interval)}).
+			Filter("scale", ffmpeg.Args{fmt.Sprintf("%d:-2", tileWidth)}).
+			Filter("tile", ffmpeg.Args{fmt.Sprintf("%vx%v", cols, rows)})
+		kw["fps_mode"] = "vfr"
+		if err := writeImage(sheet, paths[i], kw); err != nil {
+			return nil, false, err
 		}
-		return box, nil
 	}
+	return lastStream, input.canCopy, nil
 }
@@ -0,0 +1,107 @@
+package interpreter
+
+import (
+	"strings"
+	"testing"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// flipGraph runs flip on a plain input and returns the filter graph of
+// the command ffmpeg would be given
+func flipGraph(t *testing.T, direction string, media *MediaInfo) (string, *Stream) {
+	t.Helper()
+	input := &Stream{FFStream: ffmpeg.Input("in.mp4"), Media: media}
+	args := cmdArgs{values: map[string]any{"direction": direction}}
+	out, _, err := cmdFlip(NewContext(false, false), input, args)
+	if err != nil {
+		t.Fatalf("flip %q: %v", direction, err)
+	}
+	cmd := out.FFStream.Output("out.mp4").GetArgs()
+	for i, arg := range cmd {
+		if arg == "-filter_complex" && i+1 < len(cmd) {
+			return cmd[i+1], out
+		}
+	}
+	t.Fatalf("flip %q: no filter graph in %v", direction, cmd)
+	return "", nil
+}
+
+// filterNames lists the filters of a graph in order, without their
+// arguments and labels
+func filterNames(graph string) []string {
+	names := make([]string, 0)
+	for _, filter := range strings.Split(graph, ";") {
+		// skip the input labels, e.g. [0] or [s1][s2]
+		for strings.HasPrefix(filter, "[") {
+			_, filter, _ = strings.Cut(filter, "]")
+		}
+		end := strings.IndexAny(filter, "=[")
+		if end < 0 {
+			end = len(filter)
+		}
+		names = append(names, filter[:end])
+	}
+	return names
+}
+
+func TestFlipFilters(t *testing.T) {
+	tests := []struct {
+		direction string
+		want      []string
+	}{
+		{"h", []string{"hflip"}},
+		{"v", []string{"vflip"}},
+		{"both", []string{"hflip", "vflip"}},
+		{"mirror", []string{"split", "hflip", "hstack"}},
+	}
+	for _, tt := range tests {
+		graph, _ := flipGraph(t, tt.direction, nil)
+		got := filterNames(graph)
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("flip %q: filters %v, want %v (graph %s)", tt.direction, got, tt.want, graph)
+		}
+	}
+}
+
+func TestFlipMirrorWidth(t *testing.T) {
+	_, out := flipGraph(t, "mirror", &MediaInfo{Width: 1280, Height: 720})
+	if out.Media.Width != 2560 || out.Media.Height != 720 {
+		t.Errorf("mirror of 1280x720 is %dx%d, want 2560x720", out.Media.Width, out.Media.Height)
+	}
+}
+
+func TestTextEscaping(t *testing.T) {
+	// option level escaping by text, then graph level by ffmpeg-go
+	tests := []struct{ text, want string }{
+		{"plain", "text=plain:"},
+		{"5:00", `text=5\\:00:`},
+		{"It's", `text=It\\\'s:`},
+		{`a\b`, `text=a\\\\b:`},
+		{"[a], b; c", `text=\[a\]\, b\; c:`},
+	}
+	for _, tt := range tests {
+		input := &Stream{FFStream: ffmpeg.Input("in.mp4")}
+		args := cmdArgs{values: map[string]any{
+			"text": tt.text, "x": "center", "y": "bottom", "size": 48.0,
+			"color": "white", "font": "", "from": -1.0, "to": -1.0,
+			"box": false, "boxcolor": "black@0.5",
+		}}
+		out, _, err := cmdText(NewContext(false, false), input, args)
+		if err != nil {
+			t.Fatalf("text %q: %v", tt.text, err)
+		}
+		cmd := strings.Join(out.FFStream.Output("out.mp4").GetArgs(), " ")
+		if !strings.Contains(cmd, "drawtext="+tt.want) {
+			t.Errorf("text %q: %s does not contain drawtext=%s", tt.text, cmd, tt.want)
+		}
+	}
+}
+
+func TestTextNamedArg(t *testing.T) {
+	// text is a command, naming its text parameter must still parse
+	script := "x := open \"a.mp4\" |> text text=\"hi\" x=right\ny := x |> text \"a\" |> text text=\"b\""
+	if err := Check(script, Options{}); err != nil {
+		t.Errorf("Check(%q) = %v", script, err)
+	}
+}
@@ -0,0 +1,35 @@
+package interpreter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Config holds project defaults, read from the JSON file given with
+// -config. Scripts override them.
+type Config struct {
+	Canvas  Canvas            `json:"canvas"`
+	Presets map[string]Preset `json:"presets"` // added to the builtin export presets
+}
+
+// LoadConfig reads a config file
+func LoadConfig(path string) (Config, error) {
+	var cfg Config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return cfg, fmt.Errorf("invalid config %s: %v", path, err)
+	}
+	for name, p := range cfg.Presets {
+		if err := p.check(); err != nil {
+			return cfg, fmt.Errorf("invalid config %s: preset %s: %v", path, name, err)
+		}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,425 @@
+package interpreter
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/andyp1xe1/vidlang/language/commands"
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// encoding holds the encoder settings given to export, validated against
+// commands.Encoders
+type encoding struct {
+	vcodec    string
+	acodec    string
+	crf       float64 // -1 when not given
+	bitrate   string
+	abitrate  string
+	speed     string
+	profile   string
+	format    string
+	faststart bool
+	size      string // target file size, encoded in two passes to fit it
+	dither    string
+	loop      float64
+}
+
+func encodingArgs(args cmdArgs) encoding {
+	return encoding{
+		vcodec:    args.string("vcodec"),
+		acodec:    args.string("acodec"),
+		crf:       args.number("crf"),
+		bitrate:   args.string("bitrate"),
+		abitrate:  args.string("abitrate"),
+		speed:     args.string("speed"),
+		profile:   args.string("profile"),
+		format:    args.string("format"),
+		faststart: args.bool("faststart"),
+		size:      args.string("size"),
+		dither:    args.string("dither"),
+		loop:      args.number("loop"),
+	}
+}
+
+// copyable reports whether the output can take copied streams, animations,
+// frames and audio files are always encoded
+func (e encoding) copyable() bool {
+	return !e.animated() && !e.audioOnly() && e.format != "frames"
+}
+
+// audioOnly reports whether the output is an audio file
+func (e encoding) audioOnly() bool {
+	return commands.Containers[e.format].AudioOnly
+}
+
+// animated reports whether the output is a gif or webp animation
+func (e encoding) animated() bool {
+	return commands.Containers[e.format].Animated
+}
+
+// animatedGraph scales in to the canvas width keeping its aspect ratio,
+// or to the given height when it is not zero, at the canvas frame rate.
+// gifs get a palette made for the clip, built on a split of the scaled
+// stream, instead of the generic 256 colors.
+func (e encoding) animatedGraph(in *ffmpeg.Stream, canvas Canvas, height int) *ffmpeg.Stream {
+	h := -1
+	if height != 0 {
+		h = height
+	}
+	scaled := in.
+		Filter("fps", ffmpeg.Args{fmt.Sprintf("%v", canvas.FPS)}).
+		Filter("scale", ffmpeg.Args{fmt.Sprintf("%d:%d", canvas.Width, h)}, ffmpeg.KwArgs{"flags": "lanczos"})
+	if e.format != "gif" {
+		return scaled
+	}
+	split := scaled.Split()
+	palette := split.Get("0").Filter("palettegen", nil)
+	kw := ffmpeg.KwArgs{}
+	if e.dither != "" {
+		kw["dither"] = e.dither
+	}
+	return ffmpeg.Filter([]*ffmpeg.Stream{split.Get("1"), palette}, "paletteuse", nil, kw)
+}
+
+// with returns e with the settings given in o, unset ones are kept
+func (e encoding) with(o encoding) encoding {
+	if o.vcodec != "" && o.vcodec != e.vcodec {
+		// speed presets and profiles belong to one encoder
+		e.vcodec, e.speed, e.profile = o.vcodec, "", ""
+	}
+	if o.acodec != "" {
+		e.acodec = o.acodec
+	}
+	if o.crf >= 0 {
+		e.crf = o.crf
+		e.bitrate = ""
+	}
+	if o.bitrate != "" {
+		e.bitrate = o.bitrate
+		e.crf = -1
+	}
+	if o.abitrate != "" {
+		e.abitrate = o.abitrate
+	}
+	if o.speed != "" {
+		e.speed = o.speed
+	}
+	if o.profile != "" {
+		e.profile = o.profile
+	}
+	if o.format != "" {
+		e.format = o.format
+	}
+	if o.faststart {
+		e.faststart = true
+	}
+	if o.dither != "" {
+		e.dither = o.dither
+	}
+	if o.loop != 0 {
+		e.loop = o.loop
+	}
+	if o.size != "" {
+		// the size decides the bitrate, unless it is given too
+		e.size = o.size
+		if o.crf < 0 {
+			e.crf = -1
+		}
+		if o.bitrate == "" {
+			e.bitrate = ""
+		}
+	}
+	return e
+}
+
+// isSet reports whether any setting was given, a stream that could be
+// copied is then encoded instead
+func (e encoding) isSet() bool {
+	return e != encoding{crf: -1}
+}
+
+var bitratePattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?[kKmM]?$`)
+
+// resolve fills in the container from the output path and the default
+// encoders for it, then checks the settings fit together
+func (e encoding) resolve(path string) (encoding, error) {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	if ext == "ts" {
+		ext = "mpegts"
+	}
+	if _, ok := commands.Containers[ext]; ok {
+		if e.format == "" {
+			e.format = ext
+		} else if e.format != ext {
+			return e, fmt.Errorf("%s is written as %s, which does not match its extension", filepath.Base(path), e.format)
+		}
+	}
+	if isFramePattern(path) {
+		if e.format == "" {
+			e.format = "frames"
+		} else if e.format != "frames" {
+			return e, fmt.Errorf("%s numbers frames, it can't be written as %s", filepath.Base(path), e.format)
+		}
+	} else if e.format == "frames" {
+		return e, fmt.Errorf("frames need a numbered file name such as %%05d.png, got %s", filepath.Base(path))
+	}
+	container, ok := commands.Containers[e.format]
+	if !ok {
+		container = commands.Containers["mp4"]
+	}
+	if e.format == "frames" && e.vcodec == "" {
+		e.vcodec, ok = imageEncoders["."+ext]
+		if !ok {
+			return e, fmt.Errorf("can't write frames as .%s", ext)
+		}
+	}
+	if container.AudioOnly {
+		if e.vcodec != "" || e.crf >= 0 || e.bitrate != "" || e.speed != "" || e.profile != "" || e.size != "" {
+			return e, fmt.Errorf("%s files can't hold video, vcodec, crf, bitrate, speed, profile and size don't apply", e.format)
+		}
+	} else if e.vcodec == "" {
+		e.vcodec = container.VCodec
+	}
+	if container.ACodec == "" {
+		if e.acodec != "" || e.abitrate != "" {
+			return e, fmt.Errorf("%s files can't hold audio", e.format)
+		}
+	} else if e.acodec == "" {
+		e.acodec = container.ACodec
+	}
+	return e, e.validate()
+}
+
+func (e encoding) validate() error {
+	for _, name := range []string{e.vcodec, e.acodec} {
+		if name == "copy" || name == "" {
+			continue
+		}
+		enc := commands.Encoders[name]
+		if e.format != "" && !slices.Contains(enc.Formats, e.format) {
+			return fmt.Errorf("%s can't be written to %s, it goes in %s", name, e.format, strings.Join(enc.Formats, ", "))
+		}
+	}
+
+	video := commands.Encoders[e.vcodec]
+	if e.vcodec == "copy" && (e.crf >= 0 || e.bitrate != "" || e.speed != "" || e.profile != "") {
+		return fmt.Errorf("video settings can't be used when copying the video")
+	}
+	if e.crf >= 0 {
+		if video.CRF == [2]float64{} {
+			return fmt.Errorf("%s does not support crf, use bitrate", e.vcodec)
+		}
+		if e.crf < video.CRF[0] || e.crf > video.CRF[1] {
+			return fmt.Errorf("crf for %s must be between %v and %v, got %v", e.vcodec, video.CRF[0], video.CRF[1], e.crf)
+		}
+		if e.bitrate != "" {
+			return fmt.Errorf("crf and bitrate can't be combined")
+		}
+	}
+	for _, b := range []struct{ name, value string }{{"bitrate", e.bitrate}, {"abitrate", e.abitrate}} {
+		if b.value != "" && !bitratePattern.MatchString(b.value) {
+			return fmt.Errorf("%s must look like 5M or 192k, got %q", b.name, b.value)
+		}
+	}
+	if e.abitrate != "" && e.acodec == "copy" {
+		return fmt.Errorf("abitrate can't be used when copying the audio")
+	}
+	if e.speed != "" && !slices.Contains(video.Speeds, e.speed) {
+		if video.Speeds == nil {
+			return fmt.Errorf("%s does not support speed presets", e.vcodec)
+		}
+		return fmt.Errorf("speed for %s must be one of %s, got %q", e.vcodec, strings.Join(video.Speeds, ", "), e.speed)
+	}
+	if e.profile != "" && !slices.Contains(video.Profiles, e.profile) {
+		if video.Profiles == nil {
+			return fmt.Errorf("%s does not support profiles", e.vcodec)
+		}
+		return fmt.Errorf("profile for %s must be one of %s, got %q", e.vcodec, strings.Join(video.Profiles, ", "), e.profile)
+	}
+	if e.faststart && e.format != "mp4" && e.format != "mov" {
+		return fmt.Errorf("faststart only applies to mp4 and mov files")
+	}
+	if e.dither != "" && e.format != "gif" {
+		return fmt.Errorf("dither only applies to gif files")
+	}
+	if e.loop != 0 && !e.animated() {
+		return fmt.Errorf("loop only applies to gif and webp files")
+	}
+	if e.loop < -1 || e.loop != math.Trunc(e.loop) {
+		return fmt.Errorf("loop must be a whole number of at least -1, got %v", e.loop)
+	}
+	if e.size != "" {
+		if _, err := parseSize(e.size); err != nil {
+			return err
+		}
+		if e.vcodec != "libx264" {
+			return fmt.Errorf("size is only supported with libx264, got %s", e.vcodec)
+		}
+		if e.crf >= 0 || e.bitrate != "" {
+			return fmt.Errorf("size can't be combined with crf or bitrate")
+		}
+		if e.acodec == "copy" {
+			return fmt.Errorf("size can't be used when copying the audio")
+		}
+	}
+	return nil
+}
+
+var sizePattern = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?) ?([KMG]I?B|B)?$`)
+
+var sizeUnits = map[string]float64{
+	"": 1, "B": 1,
+	"KB": 1e3, "MB": 1e6, "GB": 1e9,
+	"KIB": 1 << 10, "MIB": 1 << 20, "GIB": 1 << 30,
+}
+
+// parseSize reads a file size such as 8MB or 1.5GiB in bytes
+func parseSize(s string) (int64, error) {
+	m := sizePattern.FindStringSubmatch(strings.ToUpper(s))
+	if m == nil {
+		return 0, fmt.Errorf("size must look like 8MB or 700KiB, got %q", s)
+	}
+	n, _ := strconv.ParseFloat(m[1], 64)
+	bytes := int64(n * sizeUnits[m[2]])
+	if bytes <= 0 {
+		return 0, fmt.Errorf("size must be positive, got %q", s)
+	}
+	return bytes, nil
+}
+
+// parseBitrate reads a bitrate such as 128k in bits per second
+func parseBitrate(s string) float64 {
+	mult := 1.0
+	switch s[len(s)-1] {
+	case 'k', 'K':
+		mult, s = 1e3, s[:len(s)-1]
+	case 'm', 'M':
+		mult, s = 1e6, s[:len(s)-1]
+	}
+	n, _ := strconv.ParseFloat(s, 64)
+	return n * mult
+}
+
+const (
+	// muxOverhead is the share of a file taken by the container, kept
+	// free when encoding to a size
+	muxOverhead = 0.03
+	// minVideoBitrate is the lowest bitrate a size may come down to
+	minVideoBitrate = 50e3
+	// defaultAudioBitrate is what the audio encoders are assumed to use
+	// when no abitrate is given
+	defaultAudioBitrate = "128k"
+)
+
+// sizeBitrate returns the video bitrate that makes a clip of the given
+// duration fit the target size, along with the audio bitrate it assumes
+func (e encoding) sizeBitrate(info *MediaInfo) (video, audio string, err error) {
+	size, err := parseSize(e.size)
+	if err != nil {
+		return "", "", err
+	}
+	if info == nil || info.Duration == 0 {
+		return "", "", fmt.Errorf("size needs the duration of the clip, which is unknown")
+	}
+	audioRate := 0.0
+	if e.acodec != "" && info.HasAudio {
+		audio = e.abitrate
+		if audio == "" {
+			audio = defaultAudioBitrate
+		}
+		audioRate = parseBitrate(audio)
+	}
+	total := float64(size) * 8 * (1 - muxOverhead) / info.Duration
+	videoRate := total - audioRate
+	if videoRate < minVideoBitrate {
+		return "", "", fmt.Errorf("%s is too small for %.1fs of video", e.size, info.Duration)
+	}
+	return fmt.Sprintf("%dk", int64(videoRate/1000)), audio, nil
+}
+
+// profilePixFmts are the pixel formats profiles limited to one bit depth
+// or chroma layout need
+var profilePixFmts = map[string]string{
+	"high10":     "yuv420p10le",
+	"high422":    "yuv422p",
+	"high444":    "yuv444p",
+	"main10":     "yuv420p10le",
+	"main12":     "yuv420p12le",
+	"main422-10": "yuv422p10le",
+	"main444-8":  "yuv444p",
+	"main444-10": "yuv444p10le",
+}
+
+// pixFmt is the pixel format to encode in, the canvas one unless the
+// encoder or the profile can't take it
+func (e encoding) pixFmt(canvas Canvas) string {
+	if pf, ok := profilePixFmts[e.profile]; ok {
+		return pf
+	}
+	fmts := commands.Encoders[e.vcodec].PixFmts
+	if fmts == nil || slices.Contains(fmts, canvas.PixFmt) {
+		return canvas.PixFmt
+	}
+	return fmts[0]
+}
+
+// apply adds the ffmpeg output options of the settings
+func (e encoding) apply(kw ffmpeg.KwArgs, canvas Canvas) {
+	switch e.vcodec {
+	case "":
+		kw["vn"] = ""
+	case "copy":
+		kw["c:v"] = e.vcodec
+	default:
+		kw["c:v"] = e.vcodec
+		kw["pix_fmt"] = e.pixFmt(canvas)
+	}
+	switch e.acodec {
+	case "":
+		kw["an"] = ""
+	case "copy":
+		kw["c:a"] = e.acodec
+	default:
+		kw["c:a"] = e.acodec
+		kw["ar"] = fmt.Sprintf("%d", canvas.SampleRate)
+	}
+	if e.crf >= 0 {
+		kw["crf"] = fmt.Sprintf("%v", e.crf)
+	}
+	if e.bitrate != "" {
+		kw["b:v"] = e.bitrate
+	}
+	if e.abitrate != "" {
+		kw["b:a"] = e.abitrate
+	}
+	if e.speed != "" {
+		kw["preset"] = e.speed
+	}
+	if e.profile != "" {
+		kw["profile:v"] = e.profile
+	}
+	if e.format != "" {
+		kw["f"] = commands.Containers[e.format].Muxer
+	}
+	if e.faststart {
+		kw["movflags"] = "+faststart"
+	}
+	if e.vcodec == "mjpeg" {
+		// the default quality of mjpeg is too low for hand-offs
+		kw["q:v"] = "2"
+	}
+	if e.animated() {
+		loop := e.loop
+		if e.format == "webp" && loop != 0 {
+			// webp counts every play, the first included
+			loop = max(loop+1, 1)
+		}
+		kw["loop"] = fmt.Sprintf("%v", loop)
+	}
+}
@@ -0,0 +1,145 @@
+package interpreter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEncodingWith(t *testing.T) {
+	web := builtinPresets["web"].encoding()
+	tests := []struct {
+		name string
+		base encoding
+		o    encoding
+		want encoding
+	}{
+		{"nothing given", web, encoding{crf: -1}, web},
+		{"codec switch clears speed and profile", web, encoding{crf: -1, vcodec: "libx265"},
+			encoding{vcodec: "libx265", acodec: "aac", crf: 23, abitrate: "128k", faststart: true}},
+		{"same codec keeps them", web, encoding{crf: -1, vcodec: "libx264"}, web},
+		{"speed after a codec switch", web, encoding{crf: -1, vcodec: "libx265", speed: "slow"},
+			encoding{vcodec: "libx265", acodec: "aac", crf: 23, abitrate: "128k", speed: "slow", faststart: true}},
+		{"bitrate replaces crf", encoding{crf: 23}, encoding{crf: -1, bitrate: "5M"}, encoding{crf: -1, bitrate: "5M"}},
+		{"crf replaces bitrate", encoding{crf: -1, bitrate: "8M"}, encoding{crf: 20}, encoding{crf: 20}},
+		{"size replaces crf", encoding{crf: 23}, encoding{crf: -1, size: "8MB"}, encoding{crf: -1, size: "8MB"}},
+		{"size replaces bitrate", encoding{crf: -1, bitrate: "8M"}, encoding{crf: -1, size: "8MB"}, encoding{crf: -1, size: "8MB"}},
+		{"size and bitrate both given", encoding{crf: 23}, encoding{crf: -1, size: "8MB", bitrate: "1M"},
+			encoding{crf: -1, size: "8MB", bitrate: "1M"}},
+	}
+	for _, tt := range tests {
+		if got := tt.base.with(tt.o); got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEncodingResolve(t *testing.T) {
+	tests := []struct {
+		name string
+		enc  encoding
+		path string
+		err  string // part of the error, empty when the settings are valid
+	}{
+		{"defaults", encoding{crf: -1}, "o.mp4", ""},
+		{"crf", encoding{crf: 20}, "o.mp4", ""},
+		{"crf out of range", encoding{crf: 60}, "o.mp4", "crf for libx264 must be between 0 and 51"},
+		{"crf and bitrate", encoding{crf: 20, bitrate: "5M"}, "o.mp4", "crf and bitrate can't be combined"},
+		{"crf without support", encoding{crf: 20, vcodec: "prores_ks"}, "o.mov", "prores_ks does not support crf"},
+		{"bitrate", encoding{crf: -1, bitrate: "2.5M", abitrate: "192k"}, "o.mp4", ""},
+		{"bad bitrate", encoding{crf: -1, bitrate: "5 Mbps"}, "o.mp4", "bitrate must look like 5M or 192k"},
+		{"speed", encoding{crf: -1, speed: "veryfast"}, "o.mp4", ""},
+		{"unknown speed", encoding{crf: -1, speed: "web"}, "o.mp4", "speed for libx264 must be one of"},
+		{"speed without support", encoding{crf: -1, speed: "slow"}, "o.webm", "libvpx-vp9 does not support speed presets"},
+		{"profile of another codec", encoding{crf: -1, vcodec: "libx265", profile: "high"}, "o.mp4", "profile for libx265 must be one of"},
+		{"copy with settings", encoding{crf: 20, vcodec: "copy"}, "o.mp4", "video settings can't be used when copying"},
+		{"codec in the wrong container", encoding{crf: -1, vcodec: "libvpx-vp9"}, "o.mov", "libvpx-vp9 can't be written to mov"},
+		{"format against extension", encoding{crf: -1, format: "mkv"}, "o.mp4", "does not match its extension"},
+		{"audio file with video settings", encoding{crf: 20}, "o.mp3", "mp3 files can't hold video"},
+		{"gif with audio", encoding{crf: -1, acodec: "aac"}, "o.gif", "gif files can't hold audio"},
+		{"faststart", encoding{crf: -1, faststart: true}, "o.mkv", "faststart only applies to mp4 and mov"},
+		{"dither", encoding{crf: -1, dither: "bayer"}, "o.webp", "dither only applies to gif"},
+		{"loop", encoding{crf: -1, loop: 2}, "o.mp4", "loop only applies to gif and webp"},
+		{"size", encoding{crf: -1, size: "8MB"}, "o.mp4", ""},
+		{"size and crf", encoding{crf: 20, size: "8MB"}, "o.mp4", "size can't be combined with crf or bitrate"},
+		{"size with another codec", encoding{crf: -1, size: "8MB", vcodec: "libx265"}, "o.mp4", "size is only supported with libx264"},
+		{"size copying audio", encoding{crf: -1, size: "8MB", acodec: "copy"}, "o.mp4", "size can't be used when copying the audio"},
+		{"bad size", encoding{crf: -1, size: "8 megs"}, "o.mp4", "size must look like 8MB"},
+	}
+	for _, tt := range tests {
+		_, err := tt.enc.resolve(tt.path)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%s: got error %v, want one containing %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int64 // 0 when s is invalid
+	}{
+		{"8MB", 8e6},
+		{"8mb", 8e6},
+		{"10 MB", 10e6},
+		{"700KB", 700e3},
+		{"700KiB", 700 << 10},
+		{"1.5GiB", 3 << 29},
+		{"2GB", 2e9},
+		{"1024", 1024},
+		{"512B", 512},
+		{"0MB", 0},
+		{"-1MB", 0},
+		{"8 megs", 0},
+		{"MB", 0},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.s)
+		if tt.want == 0 {
+			if err == nil {
+				t.Errorf("parseSize(%q) = %d, want an error", tt.s, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseSize(%q) = %d, %v, want %d", tt.s, got, err, tt.want)
+		}
+	}
+}
+
+func TestSizeBitrate(t *testing.T) {
+	withAudio := &MediaInfo{Duration: 10, HasVideo: true, HasAudio: true}
+	silent := &MediaInfo{Duration: 10, HasVideo: true}
+	tests := []struct {
+		name         string
+		enc          encoding
+		info         *MediaInfo
+		video, audio string
+		err          string
+	}{
+		// 10MB over 10s is 8Mb/s, less the 3% taken by the container
+		{"default audio", encoding{size: "10MB", acodec: "aac"}, withAudio, "7632k", "128k", ""},
+		{"given audio", encoding{size: "10MB", acodec: "aac", abitrate: "64k"}, withAudio, "7696k", "64k", ""},
+		{"clip without audio", encoding{size: "10MB", acodec: "aac"}, silent, "7760k", "", ""},
+		{"output without audio", encoding{size: "10MB"}, withAudio, "7760k", "", ""},
+		{"binary units", encoding{size: "10MiB"}, silent, "8136k", "", ""},
+		{"too small", encoding{size: "100KB", acodec: "aac"}, withAudio, "", "", "100KB is too small for 10.0s of video"},
+		{"audio takes it all", encoding{size: "200KB", acodec: "aac", abitrate: "192k"}, withAudio, "", "", "is too small"},
+		{"unknown duration", encoding{size: "10MB"}, &MediaInfo{HasVideo: true}, "", "", "size needs the duration of the clip"},
+		{"unknown info", encoding{size: "10MB"}, nil, "", "", "size needs the duration of the clip"},
+	}
+	for _, tt := range tests {
+		video, audio, err := tt.enc.sizeBitrate(tt.info)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: got error %v, want one containing %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || video != tt.video || audio != tt.audio {
+			t.Errorf("%s: got %s, %s, %v, want %s, %s", tt.name, video, audio, err, tt.video, tt.audio)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package interpreter
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/andyp1xe1/vidlang/language/parser"
+)
+
+// evalValue evaluates a value that is not a stream: literals, variables,
+// math, comparisons, boolean operators and inline conditionals
+func evalValue(ctx *Context, v parser.NodeValue) (ValueBox, error) {
+	switch n := v.(type) {
+	case parser.NodeLiteralBool, parser.NodeLiteralNumber, parser.NodeLiteralString:
+		return literalToBox(n), nil
+	case parser.NodeInterpolation:
+		return interpolate(ctx, n)
+	case parser.NodeIdent:
+		return ctx.getVar(n)
+	case parser.NodeVar:
+		return ctx.getVar(n.Name)
+	case parser.NodeExprMath:
+		return evalBinary(ctx, n)
+	case parser.NodeUnary:
+		b, err := evalBool(ctx, n.Operand, "operand of not")
+		if err != nil {
+			return ValueBox{}, err
+		}
+		return ValueBox{parser.NodeLiteralBool(!b), ValueBool}, nil
+	case parser.NodeCond:
+		branch, err := resolveCond(ctx, n)
+		if err != nil {
+			return ValueBox{}, err
+		}
+		return evalValue(ctx, branch)
+	case parser.NodeCall:
+		return evalCall(ctx, n)
+	case parser.NodeIndex:
+		return evalIndex(ctx, n)
+	case parser.NodeList[parser.NodeValue]:
+		return evalList(ctx, n)
+	case parser.NodeSubExpr:
+		return ValueBox{n, ValueSubExpr}, nil
+	}
+	return ValueBox{}, fmt.Errorf("cannot evaluate %s", v)
+}
+
+// evalList evaluates the items of a list literal, stream variables are
+// taken as streams so a list can collect clips
+func evalList(ctx *Context, list parser.NodeList[parser.NodeValue]) (ValueBox, error) {
+	items := make([]ValueBox, 0, len(list))
+	for _, item := range list {
+		if ident, ok := parser.VarName(item); ok && ctx.isStream(ident) {
+			entry, canCopy, err := ctx.getStream(ident)
+			if err != nil {
+				return ValueBox{}, err
+			}
+			items = append(items, ValueBox{streamArg{entry, canCopy}, ValueStream})
+			continue
+		}
+		box, err := evalValue(ctx, item)
+		if err != nil {
+			return ValueBox{}, err
+		}
+		items = append(items, box)
+	}
+	return ValueBox{items, ValueList}, nil
+}
+
+// evalRange returns the numbers from start up to, not including, end
+func evalRange(start, end float64) (ValueBox, error) {
+	if start != math.Trunc(start) || end != math.Trunc(end) {
+		return ValueBox{}, fmt.Errorf("range bounds must be whole numbers, got %v..%v", start, end)
+	}
+	if end-start > maxRangeLen {
+		return ValueBox{}, fmt.Errorf("range %v..%v is too long, at most %d items", start, end, maxRangeLen)
+	}
+	items := make([]ValueBox, 0)
+	for i := start; i < end; i++ {
+		items = append(items, ValueBox{parser.NodeLiteralNumber(i), ValueNumber})
+	}
+	return ValueBox{items, ValueList}, nil
+}
+
+const maxRangeLen = 1 << 20
+
+// evalBool evaluates a value that must be a bool, what names it in errors
+func evalBool(ctx *Context, v parser.NodeValue, what string) (bool, error) {
+	box, err := evalValue(ctx, v)
+	if err != nil {
+		return false, err
+	}
+	if box.typ != ValueBool {
+		return false, fmt.Errorf("%s must be a bool but got %v %s", what, box.typ, v)
+	}
+	return boxToPrimitive(box).(bool), nil
+}
+
+// resolveCond picks the branch of an inline conditional, following nested
+// conditionals, without evaluating it, since it may be a pipeline
+func resolveCond(ctx *Context, v parser.NodeValue) (parser.NodeValue, error) {
+	for {
+		cond, ok := v.(parser.NodeCond)
+		if !ok {
+			return v, nil
+		}
+		b, err := evalBool(ctx, cond.Cond, "if condition")
+		if err != nil {
+			return nil, err
+		}
+		if b {
+			v = cond.Then
+		} else {
+			v = cond.Else
+		}
+	}
+}
+
+func evalBinary(ctx *Context, n parser.NodeExprMath) (ValueBox, error) {
+	if n.Op.IsLogical() {
+		// and/or short-circuit, the right side may rely on the left one
+		left, err := evalBool(ctx, n.Left, fmt.Sprintf("left operand of %s", n.Op))
+		if err != nil {
+			return ValueBox{}, err
+		}
+		if (n.Op == parser.OpAnd && !left) || (n.Op == parser.OpOr && left) {
+			return ValueBox{parser.NodeLiteralBool(left), ValueBool}, nil
+		}
+		right, err := evalBool(ctx, n.Right, fmt.Sprintf("right operand of %s", n.Op))
+		if err != nil {
+			return ValueBox{}, err
+		}
+		return ValueBox{parser.NodeLiteralBool(right), ValueBool}, nil
+	}
+
+	left, err := evalValue(ctx, n.Left)
+	if err != nil {
+		return ValueBox{}, err
+	}
+	right, err := evalValue(ctx, n.Right)
+	if err != nil {
+		return ValueBox{}, err
+	}
+
+	if n.Op == parser.OpEq || n.Op == parser.OpNotEq {
+		if left.typ != right.typ {
+			return ValueBox{}, fmt.Errorf("cannot compare %v %s with %v %s", left.typ, n.Left, right.typ, n.Right)
+		}
+		switch left.typ {
+		case ValueBool, ValueNumber, ValueString:
+		default:
+			return ValueBox{}, fmt.Errorf("cannot compare values of type %v", left.typ)
+		}
+		eq := boxToPrimitive(left) == boxToPrimitive(right)
+		return ValueBox{parser.NodeLiteralBool(eq == (n.Op == parser.OpEq)), ValueBool}, nil
+	}
+
+	if n.Op == parser.OpAdd && left.typ == ValueList && right.typ == ValueList {
+		items := append(append([]ValueBox{}, left.any.([]ValueBox)...), right.any.([]ValueBox)...)
+		return ValueBox{items, ValueList}, nil
+	}
+
+	if left.typ != ValueNumber || right.typ != ValueNumber {
+		return ValueBox{}, fmt.Errorf("operator %s expects numbers but got %v %s and %v %s",
+			n.Op, left.typ, n.Left, right.typ, n.Right)
+	}
+	a, b := boxToPrimitive(left).(float64), boxToPrimitive(right).(float64)
+	if n.Op == parser.OpRange {
+		return evalRange(a, b)
+	}
+
+	var res any
+	switch n.Op {
+	case parser.OpAdd:
+		res = parser.NodeLiteralNumber(a + b)
+	case parser.OpSub:
+		res = parser.NodeLiteralNumber(a - b)
+	case parser.OpMul:
+		res = parser.NodeLiteralNumber(a * b)
+	case parser.OpDiv:
+		if b == 0 {
+			return ValueBox{}, fmt.Errorf("division by zero in %s", n)
+		}
+		res = parser.NodeLiteralNumber(a / b)
+	case parser.OpLess:
+		res = parser.NodeLiteralBool(a < b)
+	case parser.OpLessEq:
+		res = parser.NodeLiteralBool(a <= b)
+	case parser.OpGreater:
+		res = parser.NodeLiteralBool(a > b)
+	case parser.OpGreaterEq:
+		res = parser.NodeLiteralBool(a >= b)
+	default:
+		return ValueBox{}, fmt.Errorf("unknown operator %s", n.Op)
+	}
+
+	if n.Op.IsComparison() {
+		return ValueBox{res, ValueBool}, nil
+	}
+	return ValueBox{res, ValueNumber}, nil
+}
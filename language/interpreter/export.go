@@ -0,0 +1,137 @@
+package interpreter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// outputPaths names the file each exported stream is written to. The path
+// may hold placeholders filled from the stream's origin: {name} the source
+// file name without extension, {ext} its extension without the dot,
+// {index} the position of the stream and {date} the creation date of the
+// source. Without placeholders several streams get an index appended.
+func outputPaths(path string, streams []*Stream) ([]string, error) {
+	if !strings.Contains(path, "{") {
+		if len(streams) == 1 {
+			return []string{path}, nil
+		}
+		ext := getFileExtension(path)
+		base := path[:len(path)-len(ext)]
+		paths := make([]string, 0, len(streams))
+		for i := range streams {
+			paths = append(paths, fmt.Sprintf("%s_%d%s", base, i, ext))
+		}
+		return paths, nil
+	}
+
+	paths := make([]string, 0, len(streams))
+	seen := make(map[string]bool, len(streams))
+	for i, stream := range streams {
+		out, err := expandPathTemplate(path, stream.Origin, i)
+		if err != nil {
+			return nil, err
+		}
+		if seen[out] {
+			return nil, fmt.Errorf("export path %s names several streams %s, add {index} or {name}", path, out)
+		}
+		seen[out] = true
+		paths = append(paths, out)
+	}
+	return paths, nil
+}
+
+func expandPathTemplate(path string, origin *Origin, index int) (string, error) {
+	var sb strings.Builder
+	rest := path
+	for {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			sb.WriteString(rest)
+			break
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated placeholder in export path %s", path)
+		}
+		sb.WriteString(rest[:open])
+		name := rest[open+1 : open+end]
+		rest = rest[open+end+1:]
+
+		if name == "index" {
+			sb.WriteString(strconv.Itoa(index))
+			continue
+		}
+		if origin == nil {
+			return "", fmt.Errorf("{%s} in export path %s needs a stream opened from a file", name, path)
+		}
+		switch name {
+		case "name":
+			sb.WriteString(origin.Name())
+		case "ext":
+			sb.WriteString(strings.TrimPrefix(origin.Ext(), "."))
+		case "date":
+			sb.WriteString(origin.Date().Format(time.DateOnly))
+		default:
+			return "", fmt.Errorf("unknown placeholder {%s} in export path %s, expected {name}, {ext}, {index} or {date}", name, path)
+		}
+	}
+	return sb.String(), nil
+}
+
+// makeOutputDir creates the missing directories of an output file
+func makeOutputDir(path string) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("cannot create output directory: %w", err)
+	}
+	return nil
+}
+
+// runOutput runs ffmpeg for an output, with its log in the error
+func runOutput(out *ffmpeg.Stream) error {
+	var errBuf strings.Builder
+	if err := out.ErrorToStdOut().WithErrorOutput(&errBuf).Run(); err != nil {
+		return fmt.Errorf("export failed: %w\nFFmpeg output:\n%s", err, errBuf.String())
+	}
+	return nil
+}
+
+// firstPass runs the analysis pass of a two pass encode, writing its log
+// to passlog. The output arguments are those of the second pass.
+func firstPass(stream *ffmpeg.Stream, ffargs ffmpeg.KwArgs, passlog string) error {
+	args := make(ffmpeg.KwArgs, len(ffargs))
+	for k, v := range ffargs {
+		switch k {
+		case "c:a", "b:a", "ar", "movflags":
+		default:
+			args[k] = v
+		}
+	}
+	args["an"] = ""
+	args["f"] = "null"
+	args["pass"] = "1"
+	args["passlogfile"] = passlog
+	return runOutput(stream.Output(os.DevNull, args))
+}
+
+// checkSize fails when an export encoded to a size came out larger
+func checkSize(path, size string) error {
+	limit, err := parseSize(size)
+	if err != nil {
+		return err
+	}
+	st, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if st.Size() > limit {
+		return fmt.Errorf("%s came out at %d bytes, over the %s target", path, st.Size(), size)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package interpreter
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Flags are the command line flags shared by the vidlang commands, so the
+// entry points can't drift apart
+type Flags struct {
+	Script string // script file, empty when reading stdin
+	Stdin  bool
+	Check  bool // check the script without running it
+
+	debug     bool
+	noPreview bool
+	noCheck   bool
+	root      string
+	config    string
+	canvas    string
+	vars      VarFlags
+}
+
+// RegisterFlags defines the shared flags on fs, they are set once fs is
+// parsed
+func RegisterFlags(fs *flag.FlagSet) *Flags {
+	f := &Flags{vars: make(VarFlags)}
+	fs.StringVar(&f.Script, "script", "", "script file to parse")
+	fs.BoolVar(&f.Stdin, "stdin", false, "read script from stdin")
+	fs.BoolVar(&f.debug, "debug", false, "enable debug mode")
+	fs.BoolVar(&f.noPreview, "nopreview", false, "don't open a preview of the result")
+	fs.BoolVar(&f.Check, "check", false, "check the script for errors without running it")
+	fs.BoolVar(&f.noCheck, "nocheck", false, "skip the static check before running")
+	fs.StringVar(&f.root, "root", "", "directory open and export paths are relative to, defaults to the script's")
+	fs.StringVar(&f.config, "config", "", "JSON file with project defaults such as the canvas")
+	fs.StringVar(&f.canvas, "canvas", "", "project canvas as WIDTHxHEIGHT or WIDTHxHEIGHT@FPS, overrides the config")
+	fs.Var(f.vars, "var", "set a script variable, name=value, can be repeated")
+	return f
+}
+
+// Options builds the interpreter options from the flags, args are the
+// positional parameters of the script. The config file is read here.
+func (f *Flags) Options(args []string) (Options, error) {
+	opts := Options{
+		Debug:   f.debug,
+		Preview: !f.noPreview,
+		NoCheck: f.noCheck,
+		Path:    f.Script,
+		Root:    f.root,
+		Vars:    f.vars,
+		Args:    args,
+	}
+	if f.Stdin {
+		opts.Path = ""
+	}
+	if f.config != "" {
+		cfg, err := LoadConfig(f.config)
+		if err != nil {
+			return opts, fmt.Errorf("failed to read config: %v", err)
+		}
+		opts.Config = cfg
+	}
+	if f.canvas != "" {
+		canvas, err := ParseCanvas(f.canvas)
+		if err != nil {
+			return opts, fmt.Errorf("invalid -canvas: %v", err)
+		}
+		opts.Canvas = canvas
+	}
+	return opts, nil
+}
+
+// ReadScript reads the script from stdin or from the -script file
+func (f *Flags) ReadScript() (string, error) {
+	if f.Stdin {
+		res, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", fmt.Errorf("failed to read stdin: %v", err)
+		}
+		return string(res), nil
+	}
+	res, err := os.ReadFile(f.Script)
+	if err != nil {
+		return "", fmt.Errorf("failed to read script file: %v", err)
+	}
+	return string(res), nil
+}
@@ -0,0 +1,38 @@
+package interpreter
+
+import (
+	"flag"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestFlagsOptions(t *testing.T) {
+	fs := flag.NewFlagSet("vidlang", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	flags := RegisterFlags(fs)
+	err := fs.Parse([]string{"-script", "a.vl", "-nopreview", "-nocheck", "-root", "media",
+		"-canvas", "1280x720@25", "-var", "title=\"hi\"", "-var", "n=2", "x", "3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts, err := flags.Options(fs.Args())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Options{
+		NoCheck: true,
+		Path:    "a.vl",
+		Root:    "media",
+		Vars:    map[string]string{"title": `"hi"`, "n": "2"},
+		Args:    []string{"x", "3"},
+		Canvas:  Canvas{Width: 1280, Height: 720, FPS: 25},
+	}
+	if !reflect.DeepEqual(opts, want) {
+		t.Errorf("Options = %+v, want %+v", opts, want)
+	}
+
+	if err := fs.Parse([]string{"-var", "bad"}); err == nil {
+		t.Errorf("-var without a value was accepted")
+	}
+}
@@ -0,0 +1,137 @@
+package interpreter
+
+import (
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/andyp1xe1/vidlang/language/commands"
+	"github.com/andyp1xe1/vidlang/language/parser"
+)
+
+type funcHandler func(*Context, cmdArgs) (ValueBox, error)
+
+var funcMap = map[string]funcHandler{
+	"env":      fnEnv,
+	"duration": fnDuration,
+	"width":    fnWidth,
+	"height":   fnHeight,
+	"fps":      fnFPS,
+	"hasaudio": fnHasAudio,
+}
+
+// every registered function needs a handler
+func init() {
+	for _, fn := range commands.AllFunctions() {
+		if _, ok := funcMap[fn.Name]; !ok {
+			panic(fmt.Sprintf("interpreter: function %s has no handler", fn.Name))
+		}
+	}
+}
+
+func evalCall(ctx *Context, call parser.NodeCall) (ValueBox, error) {
+	fn, ok := commands.LookupFunction(call.Name)
+	if !ok {
+		return ValueBox{}, fmt.Errorf("unknown function: %s", call.Name)
+	}
+	if len(call.Args) != len(fn.Params) {
+		return ValueBox{}, fmt.Errorf("function %s takes %d arguments, got %d", call.Name, len(fn.Params), len(call.Args))
+	}
+	args, err := bindArgs(ctx, fn.Signature, call.Args)
+	if err != nil {
+		return ValueBox{}, err
+	}
+	return funcMap[call.Name](ctx, args)
+}
+
+// evalIndex returns an item of a list, or a clip of a stream variable as
+// a stream value. Negative indexes count from the end.
+func evalIndex(ctx *Context, n parser.NodeIndex) (ValueBox, error) {
+	var items []ValueBox
+	if ident, ok := parser.VarName(n.Target); ok && ctx.isStream(ident) {
+		var err error
+		if items, err = iterItems(ctx, ident); err != nil {
+			return ValueBox{}, err
+		}
+	} else {
+		box, err := evalValue(ctx, n.Target)
+		if err != nil {
+			return ValueBox{}, err
+		}
+		if box.typ != ValueList {
+			return ValueBox{}, fmt.Errorf("cannot index %v %s", box.typ, n.Target)
+		}
+		items = box.any.([]ValueBox)
+	}
+
+	idx, err := evalValue(ctx, n.Index)
+	if err != nil {
+		return ValueBox{}, err
+	}
+	if idx.typ != ValueNumber {
+		return ValueBox{}, fmt.Errorf("index must be a number but got %v %s", idx.typ, n.Index)
+	}
+	f := boxToPrimitive(idx).(float64)
+	if f != math.Trunc(f) {
+		return ValueBox{}, fmt.Errorf("index must be a whole number, got %v", f)
+	}
+	i := int(f)
+	if i < 0 {
+		i += len(items)
+	}
+	if i < 0 || i >= len(items) {
+		return ValueBox{}, fmt.Errorf("index %v out of range for %s with %d items", f, n.Target, len(items))
+	}
+	return items[i], nil
+}
+
+func fnEnv(ctx *Context, args cmdArgs) (ValueBox, error) {
+	return ValueBox{parser.NodeLiteralString(os.Getenv(args.string("name"))), ValueString}, nil
+}
+
+// clipMedia returns the media info of the clip argument, which must be a
+// single stream
+func clipMedia(args cmdArgs) (*MediaInfo, error) {
+	streams := entryToList(args.stream("clip").entry)
+	if len(streams) != 1 {
+		return nil, fmt.Errorf("function %s expects a single clip, got %d", args.sig.Name, len(streams))
+	}
+	return mediaInfo(streams[0])
+}
+
+// clipNumber returns a number of the clip's media info, 0 being unknown
+func clipNumber(args cmdArgs, field func(*MediaInfo) float64) (ValueBox, error) {
+	info, err := clipMedia(args)
+	if err != nil {
+		return ValueBox{}, fmt.Errorf("%s: %v", args.sig.Name, err)
+	}
+	v := field(info)
+	if v == 0 {
+		return ValueBox{}, fmt.Errorf("%s of the clip is unknown", args.sig.Name)
+	}
+	return ValueBox{parser.NodeLiteralNumber(v), ValueNumber}, nil
+}
+
+func fnDuration(ctx *Context, args cmdArgs) (ValueBox, error) {
+	return clipNumber(args, func(m *MediaInfo) float64 { return m.Duration })
+}
+
+func fnWidth(ctx *Context, args cmdArgs) (ValueBox, error) {
+	return clipNumber(args, func(m *MediaInfo) float64 { return float64(m.Width) })
+}
+
+func fnHeight(ctx *Context, args cmdArgs) (ValueBox, error) {
+	return clipNumber(args, func(m *MediaInfo) float64 { return float64(m.Height) })
+}
+
+func fnFPS(ctx *Context, args cmdArgs) (ValueBox, error) {
+	return clipNumber(args, func(m *MediaInfo) float64 { return m.FPS })
+}
+
+func fnHasAudio(ctx *Context, args cmdArgs) (ValueBox, error) {
+	info, err := clipMedia(args)
+	if err != nil {
+		return ValueBox{}, fmt.Errorf("%s: %v", args.sig.Name, err)
+	}
+	return ValueBox{parser.NodeLiteralBool(info.HasAudio), ValueBool}, nil
+}
@@ -0,0 +1,163 @@
+package interpreter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/andyp1xe1/vidlang/language/parser"
+)
+
+// module is a parsed script, path is empty for a script read from stdin
+type module struct {
+	path  string
+	nodes []parser.Node
+
+	ctx *Context // context the script was run in, nil until it is first imported
+}
+
+// program is the main script and every script it imports, directly or
+// not, by resolved path. Imports are all loaded before anything is
+// checked or run, so a missing file or a cycle is reported right away.
+type program struct {
+	main    *module
+	modules map[string]*module
+}
+
+// resolveImport resolves an import path against the directory of the
+// importing script, or the working directory for stdin
+func resolveImport(from, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(filepath.Dir(from), path)
+}
+
+// inFile prefixes an error with the script it comes from
+func inFile(path string, err error) error {
+	if path == "" {
+		return err
+	}
+	return fmt.Errorf("%s: %w", path, err)
+}
+
+func loadProgram(nodes []parser.Node, path string) (*program, error) {
+	if path != "" {
+		path = filepath.Clean(path)
+	}
+	prog := &program{
+		main:    &module{path: path, nodes: nodes},
+		modules: make(map[string]*module),
+	}
+	if err := prog.loadImports(prog.main, []string{path}); err != nil {
+		return nil, err
+	}
+	return prog, nil
+}
+
+// loadImports parses the scripts imported by mod, stack holds the scripts
+// being loaded to detect cycles
+func (p *program) loadImports(mod *module, stack []string) error {
+	var imports []parser.NodeImport
+	for _, n := range mod.nodes {
+		parser.Inspect(n, func(n parser.Node) bool {
+			if imp, ok := n.(parser.NodeImport); ok {
+				imports = append(imports, imp)
+			}
+			return true
+		})
+	}
+
+	for _, imp := range imports {
+		path := resolveImport(mod.path, imp.Path)
+		if slices.Contains(stack, path) {
+			cycle := strings.Join(append(slices.Clone(stack), path), " -> ")
+			return inFile(mod.path, fmt.Errorf("import cycle %s at %d:%d", cycle, imp.Pos.Line, imp.Pos.Column))
+		}
+		if _, ok := p.modules[path]; ok {
+			continue
+		}
+
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return inFile(mod.path, fmt.Errorf("cannot import %s: %v at %d:%d", imp.Path, err, imp.Pos.Line, imp.Pos.Column))
+		}
+		nodes, err := parseModule(path, string(src))
+		if err != nil {
+			return err
+		}
+
+		m := &module{path: path, nodes: nodes}
+		p.modules[path] = m
+		if err := p.loadImports(m, append(stack, path)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseModule is parseScript for an imported script
+func parseModule(path, code string) ([]parser.Node, error) {
+	p := parser.Parse(code, false)
+	nodes := make([]parser.Node, 0)
+	for node := range p.Expressions {
+		if astErr, ok := node.(parser.AstError); ok {
+			return nil, inFile(path, astErr)
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+// qualify returns the name a definition of an imported script gets in
+// the importing one
+func qualify(alias, name parser.NodeIdent) parser.NodeIdent {
+	return alias + "." + name
+}
+
+// isQualified reports whether name belongs to an imported script
+func isQualified(name parser.NodeIdent) bool {
+	return strings.Contains(string(name), ".")
+}
+
+// evaluateImport runs the imported script in its own context, the first
+// time it is imported only, and brings its values and streams into the
+// current scope under the alias
+func evaluateImport(ctx *Context, node parser.NodeImport) error {
+	path := resolveImport(ctx.file, node.Path)
+	mod, ok := ctx.modules[path]
+	if !ok {
+		return fmt.Errorf("import %s was not loaded", node.Path)
+	}
+
+	if mod.ctx == nil {
+		modCtx := NewContext(ctx.debug, ctx.preview)
+		modCtx.file = path
+		modCtx.root = ctx.root
+		modCtx.canvas = ctx.canvas
+		modCtx.presets = ctx.presets
+		modCtx.modules = ctx.modules
+		for _, n := range mod.nodes {
+			if err := evaluate(modCtx, n); err != nil {
+				return inFile(path, err)
+			}
+		}
+		mod.ctx = modCtx
+	}
+
+	modCtx := mod.ctx
+	for name, box := range modCtx.variables {
+		ctx.setBox(qualify(node.Alias, name), box)
+	}
+	for _, name := range modCtx.streams.names() {
+		if name == globalStreamName {
+			continue
+		}
+		as := qualify(node.Alias, name)
+		delete(ctx.variables, as)
+		modCtx.streams.shareWith(ctx.streams, name, as)
+	}
+	return nil
+}
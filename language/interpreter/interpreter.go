@@ -6,9 +6,15 @@ import (
 	"os/exec"
 	"strings"
 
+	"github.com/andyp1xe1/vidlang/language/commands"
 	"github.com/andyp1xe1/vidlang/language/parser"
 )
 
+const (
+	globalStreamName parser.NodeIdent = "stream"
+	selfStarName     parser.NodeIdent = "*"
+)
+
 // StreamType represents the type of media stream
 type StreamType int
 
@@ -20,17 +26,43 @@ const (
 	ValueString
 	ValueList
 	ValueSubExpr
+	ValueStream
 )
 
+func (t valueType) String() string {
+	switch t {
+	case ValueBool:
+		return "bool"
+	case ValueNumber:
+		return "number"
+	case ValueString:
+		return "string"
+	case ValueList:
+		return "list"
+	case ValueSubExpr:
+		return "subexpression"
+	case ValueStream:
+		return "stream"
+	}
+	return "unknown"
+}
+
 type ValueBox struct {
 	any
 	typ valueType
 }
 
-// Context holds the running state of the interpreter
+// Context holds the running state of the interpreter. Nested scopes, such
+// as the body of a loop iteration, are contexts pointing to their parent.
 type Context struct {
 	variables  map[parser.NodeIdent]ValueBox
 	streams    streamStore
+	parent     *Context
+	file       string             // script being run, imports are resolved against it
+	root       string             // overrides the directory open and export paths are relative to
+	canvas     *Canvas            // project format, shared by every scope
+	presets    map[string]Preset  // export presets by name, builtin and from the config
+	modules    map[string]*module // imported scripts by resolved path
 	debug      bool
 	preview    bool
 	previewCmd *exec.Cmd
@@ -38,14 +70,77 @@ type Context struct {
 
 // NewContext creates a new interpreter context
 func NewContext(debug, preview bool) *Context {
+	canvas := defaultCanvas
 	return &Context{
 		variables: make(map[parser.NodeIdent]ValueBox),
 		streams:   newStreamStore(),
+		canvas:    &canvas,
+		presets:   builtinPresets,
 		debug:     debug,
 		preview:   preview,
 	}
 }
 
+// child returns a new scope nested in c
+func (c *Context) child() *Context {
+	return &Context{
+		variables: make(map[parser.NodeIdent]ValueBox),
+		streams:   newStreamStore(),
+		parent:    c,
+		file:      c.file,
+		root:      c.root,
+		canvas:    c.canvas,
+		presets:   c.presets,
+		modules:   c.modules,
+		debug:     c.debug,
+		preview:   c.preview,
+	}
+}
+
+// lookup returns the innermost scope defining name, as a value or a
+// stream, or nil
+func (c *Context) lookup(name parser.NodeIdent) *Context {
+	for s := c; s != nil; s = s.parent {
+		if _, ok := s.variables[name]; ok {
+			return s
+		}
+		if s.streams.has(name) {
+			return s
+		}
+	}
+	return nil
+}
+
+// assignScope returns the scope an assignment writes to: `:=` always
+// defines in the current scope, `=` updates the scope that has the name
+func (c *Context) assignScope(name parser.NodeIdent, define bool) *Context {
+	if !define {
+		if s := c.lookup(name); s != nil {
+			return s
+		}
+	}
+	return c
+}
+
+// isStream reports whether name currently refers to a stream
+func (c *Context) isStream(name parser.NodeIdent) bool {
+	s := c.lookup(name)
+	return s != nil && s.streams.has(name)
+}
+
+func (c *Context) getStream(name parser.NodeIdent) (interface{}, bool, error) {
+	s := c.lookup(name)
+	if s == nil {
+		return nil, false, fmt.Errorf("stream variable %s not defined", name)
+	}
+	return s.streams.getAuto(name)
+}
+
+func (c *Context) setStream(name parser.NodeIdent, entry interface{}, canCopy bool) {
+	delete(c.variables, name)
+	c.streams.set(name, entry, canCopy)
+}
+
 // StartPreviewPlayer launches ffplay to display the UDP stream
 // func (c *Context) StartPreviewPlayer() error {
 // 	// Kill any existing preview process
@@ -73,21 +168,21 @@ func (c *Context) StartPreviewPlayer() error {
 }
 
 func (c *Context) getVar(name parser.NodeIdent) (ValueBox, error) {
-	if name == "stream" {
+	if name == globalStreamName {
 		return ValueBox{}, fmt.Errorf("global stream is not a box value")
 	}
 
-	val, ok := c.variables[name]
-	if !ok {
+	s := c.lookup(name)
+	if s == nil {
 		return ValueBox{}, fmt.Errorf("variable %s not found", name)
 	}
+	val, ok := s.variables[name]
+	if !ok {
+		return ValueBox{}, fmt.Errorf("%s is a stream, not a value", name)
+	}
 	return val, nil
 }
 
-func (c *Context) setVar(name parser.NodeIdent, typ valueType, v any) {
-	c.variables[name] = ValueBox{v, typ}
-}
-
 func literalToBox(node parser.Node) ValueBox {
 	var box ValueBox
 	switch v := node.(type) {
@@ -108,38 +203,130 @@ func boxToPrimitive(v ValueBox) any {
 	case ValueNumber:
 		return float64(v.any.(parser.NodeLiteralNumber))
 	case ValueString:
-		return strings.Trim(v.any.(parser.NodeLiteralString).String(), "\"")
+		return string(v.any.(parser.NodeLiteralString))
 	}
 	return nil
 }
 
-func (c *Context) setLiteral(name parser.NodeIdent, node parser.Node) {
-	c.variables[name] = literalToBox(node)
+// interpolate renders a string literal with `${name}` references to string
+// and number variables
+func interpolate(ctx *Context, node parser.NodeInterpolation) (ValueBox, error) {
+	var sb strings.Builder
+	for _, part := range node.Parts {
+		switch p := part.(type) {
+		case parser.NodeLiteralString:
+			sb.WriteString(string(p))
+		case parser.NodeIdent:
+			box, err := ctx.getVar(p)
+			if err != nil {
+				return ValueBox{}, fmt.Errorf("cannot interpolate ${%s}: %v", p, err)
+			}
+			switch box.typ {
+			case ValueString:
+				sb.WriteString(boxToPrimitive(box).(string))
+			case ValueNumber:
+				sb.WriteString(box.any.(parser.NodeLiteralNumber).String())
+			default:
+				return ValueBox{}, fmt.Errorf("cannot interpolate ${%s}: expected a string or number but got %v", p, box.typ)
+			}
+		default:
+			return ValueBox{}, fmt.Errorf("unexpected %s in interpolated string", p)
+		}
+	}
+	return ValueBox{parser.NodeLiteralString(sb.String()), ValueString}, nil
 }
 
 func (c *Context) setBox(name parser.NodeIdent, box ValueBox) {
+	c.streams.remove(name)
 	c.variables[name] = box
 }
 
+// Options configure a single run of the interpreter
+type Options struct {
+	Debug   bool
+	Preview bool
+	NoCheck bool   // skip the static check before running
+	Path    string // script file, imports are relative to it, empty for stdin
+	Root    string // directory open and export paths are relative to, instead of the script's
+
+	Vars map[string]string // -var name=value parameters, typed by their syntax
+	Args []string          // positional parameters, exposed as the list args
+
+	Config Config // project defaults from a config file
+	Canvas Canvas // overrides the canvas of Config, zero fields are kept
+}
+
 type Interpreter struct {
-	ctx    *Context
-	parser *parser.Parser
+	ctx   *Context
+	nodes []parser.Node
 }
 
-func Interpret(code string, debug, preview bool) error {
-	parser := parser.Parse(code, false)
+func Interpret(code string, opts Options) error {
+	nodes, err := parseScript(code)
+	if err != nil {
+		return err
+	}
+	return InterpretNodes(nodes, opts)
+}
+
+// InterpretNodes runs already built top level nodes, e.g. ones decoded
+// with parser.DecodeJSON, without going through the lexer.
+// Unless disabled, the whole program is checked before anything runs.
+func InterpretNodes(nodes []parser.Node, opts Options) error {
+	prog, err := loadProgram(nodes, opts.Path)
+	if err != nil {
+		return err
+	}
+	globals, err := scriptGlobals(opts)
+	if err != nil {
+		return err
+	}
+	if !opts.NoCheck {
+		if err := checkProgram(prog, globals, presetTable(opts.Config.Presets)); err != nil {
+			return err
+		}
+	}
+
+	canvas := defaultCanvas.with(opts.Config.Canvas).with(opts.Canvas)
+	if err := canvas.validate(); err != nil {
+		return err
+	}
+
+	ctx := NewContext(opts.Debug, opts.Preview)
+	ctx.file = prog.main.path
+	ctx.root = opts.Root
+	*ctx.canvas = canvas
+	ctx.presets = presetTable(opts.Config.Presets)
+	ctx.modules = prog.modules
+	for name, box := range globals {
+		ctx.setBox(name, box)
+	}
 
 	i := &Interpreter{
-		parser: parser,
-		ctx:    NewContext(debug, preview),
+		nodes: nodes,
+		ctx:   ctx,
 	}
 
 	return i.run()
 }
 
+// parseScript collects every top level node of the script, stopping at
+// the first syntax error
+func parseScript(code string) ([]parser.Node, error) {
+	p := parser.Parse(code, false)
+	nodes := make([]parser.Node, 0)
+	for node := range p.Expressions {
+		if astErr, ok := node.(parser.AstError); ok {
+			return nil, fmt.Errorf("interpreter error: %v", astErr.Error())
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
 // Execute runs the interpreter on the given AST nodes
 func (i *Interpreter) run() error {
-	for node := range i.parser.Expressions {
+	for _, node := range i.nodes {
 		if err := evaluate(i.ctx, node); err != nil {
 			return err
 		}
@@ -153,12 +340,21 @@ func evaluate(ctx *Context, node parser.Node) error {
 	case parser.NodeAssign:
 		return evaluateAssignment(ctx, n)
 	case parser.NodeExpr:
+		if sig, ok := directive(n); ok {
+			return evaluateDirective(ctx, sig, n.Pipeline[0])
+		}
 		entry, canCp, err := evaluateExpression(ctx, n) // TODO factor canCopy in Stream??
 		if err != nil {
 			return err
 		}
-		ctx.streams.set("stream", entry, canCp)
+		ctx.setStream(globalStreamName, entry, canCp)
 		return nil
+	case parser.NodeIf:
+		return evaluateIf(ctx, n)
+	case parser.NodeFor:
+		return evaluateFor(ctx, n)
+	case parser.NodeImport:
+		return evaluateImport(ctx, n)
 	case parser.AstError:
 		return fmt.Errorf("interpreter error: %v", n.Error())
 
@@ -173,28 +369,117 @@ func evaluateAssignment(ctx *Context, node parser.NodeAssign) error {
 		return fmt.Errorf("invalid assignment: no destination")
 	}
 
-	var entry interface{}
-	var canCopy bool
-	var err error
-	if value, ok := node.Value.(parser.NodeExpr); ok {
-		entry, canCopy, err = evaluateExpression(ctx, value)
+	if isQualified(node.Dest[0]) {
+		return fmt.Errorf("cannot assign to %s, definitions of imported scripts are read only", node.Dest[0])
+	}
+
+	value, err := resolveCond(ctx, node.Value)
+	if err != nil {
+		return err
+	}
+
+	if expr, ok := value.(parser.NodeExpr); ok {
+		entry, canCopy, err := evaluateExpression(ctx, expr)
 		if err != nil {
 			return err
 		}
-		ctx.streams.set(node.Dest[0], entry, canCopy)
+		ctx.assignScope(node.Dest[0], node.Define).setStream(node.Dest[0], entry, canCopy)
+		if len(node.Dest) > 1 {
+			return fmt.Errorf("cannot assign stream to multiple variables for now")
+		}
+		return nil
 	}
 
 	if len(node.Dest) > 1 {
 		return fmt.Errorf("cannot assign stream to multiple variables for now")
 	}
 
-	if entry == nil {
-		ctx.setLiteral(node.Dest[0], node.Value)
+	box, err := evalValue(ctx, value)
+	if err != nil {
+		return err
+	}
+	scope := ctx.assignScope(node.Dest[0], node.Define)
+	if box.typ == ValueStream {
+		// a clip taken out of a list or a stream variable, e.g. clips[0]
+		arg := box.any.(streamArg)
+		scope.setStream(node.Dest[0], arg.entry, arg.canCopy)
+		return nil
 	}
+	scope.setBox(node.Dest[0], box)
+	return nil
+}
 
+// evaluateIf runs the statements of the branch picked by the condition.
+// Blocks don't open a new scope, names they define stay visible after.
+func evaluateIf(ctx *Context, node parser.NodeIf) error {
+	cond, err := evalBool(ctx, node.Cond, "if condition")
+	if err != nil {
+		return err
+	}
+	body := node.Else
+	if cond {
+		body = node.Then
+	}
+	for _, stmt := range body {
+		if err := evaluate(ctx, stmt); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// evaluateFor runs the body once per item, each time in a new scope
+// holding the loop variables
+func evaluateFor(ctx *Context, node parser.NodeFor) error {
+	items, err := iterItems(ctx, node.Iter)
+	if err != nil {
+		return err
+	}
+	for i, item := range items {
+		scope := ctx.child()
+		if node.Index != "" {
+			scope.setBox(node.Index, ValueBox{parser.NodeLiteralNumber(i), ValueNumber})
+		}
+		if item.typ == ValueStream {
+			arg := item.any.(streamArg)
+			scope.setStream(node.Value, arg.entry, arg.canCopy)
+		} else {
+			scope.setBox(node.Value, item)
+		}
+		for _, stmt := range node.Body {
+			if err := evaluate(scope, stmt); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// iterItems returns what a for loop goes over: the streams of a stream
+// variable or the items of a list
+func iterItems(ctx *Context, iter parser.NodeValue) ([]ValueBox, error) {
+	if ident, ok := parser.VarName(iter); ok && ctx.isStream(ident) {
+		entry, canCopy, err := ctx.getStream(ident)
+		if err != nil {
+			return nil, err
+		}
+		items := make([]ValueBox, 0)
+		for _, s := range entryToList(entry) {
+			items = append(items, ValueBox{streamArg{s, canCopy}, ValueStream})
+		}
+		return items, nil
+	}
+
+	box, err := evalValue(ctx, iter)
+	if err != nil {
+		return nil, err
+	}
+	if box.typ != ValueList {
+		return nil, fmt.Errorf("cannot iterate over %v %s", box.typ, iter)
+	}
+	return box.any.([]ValueBox), nil
+}
+
 // evaluateExpression evaluates an expression node
 func evaluateExpression(ctx *Context, expr parser.NodeExpr) (StreamList, bool, error) {
 	var entry interface{}
@@ -207,11 +492,12 @@ func evaluateExpression(ctx *Context, expr parser.NodeExpr) (StreamList, bool, e
 
 	if len(expr.Input) == 1 {
 		input := expr.Input[0]
-		v, ok := input.(parser.NodeIdent)
-		if !ok {
+		switch input.(type) {
+		case parser.NodeIdent, parser.NodeVar, parser.NodeIndex:
+		default:
 			return nil, false, fmt.Errorf("invalid input type: %T", input)
 		}
-		if entry, canCopy, err = ctx.streams.getAuto(v); err != nil {
+		if entry, canCopy, err = getStreamArg(ctx, input); err != nil {
 			return nil, false, err
 		}
 	}
@@ -229,10 +515,26 @@ func evaluatePipelineThread(ctx *Context, pipeline parser.NodePipeline, stream *
 		log.Println("thread cmd", cmd)
 		var err error
 		var canCmdCp bool
-		stream, canCmdCp, err = evaluateCommand(ctx, cmd, stream)
+		var out *Stream
+		out, canCmdCp, err = evaluateCommand(ctx, cmd, stream)
 		if err != nil {
 			return nil, false, err
 		}
+		if out != nil && stream != nil {
+			// filters keep what is known about their input
+			if out.Origin == nil {
+				out.Origin = stream.Origin
+			}
+			if out.Media == nil {
+				out.Media = stream.Media
+			}
+		}
+		if out != nil {
+			// filters only carry the video, the audio stays on the input
+			out.Edited = true
+			out.Media = withoutAudio(out.Media)
+		}
+		stream = out
 		canCopy = canCopy && canCmdCp
 	}
 
@@ -245,10 +547,14 @@ func evaluatePipeline(ctx *Context, pipeline parser.NodePipeline, entry interfac
 	// 	return []*Stream{}, false, nil
 	// }
 
-	var err error
 	first := pipeline[0]
 	if first.Name == "open" {
-		if streams, err = cmdOpen(ctx, first.Args); err != nil {
+		sig, _ := commands.Lookup(first.Name)
+		args, err := bindArgs(ctx, sig, first.Args)
+		if err != nil {
+			return StreamList{}, false, err
+		}
+		if streams, err = cmdOpen(ctx, args); err != nil {
 			return StreamList{}, false, err
 		}
 		pipeline = pipeline[1:]
@@ -279,18 +585,48 @@ func evaluatePipeline(ctx *Context, pipeline parser.NodePipeline, entry interfac
 	return results, canCopy, nil
 }
 
+// directive reports whether an expression is a directive, such as canvas
+func directive(expr parser.NodeExpr) (commands.Signature, bool) {
+	if len(expr.Pipeline) == 0 {
+		return commands.Signature{}, false
+	}
+	sig, ok := commands.Lookup(expr.Pipeline[0].Name)
+	return sig, ok && sig.Directive
+}
+
+func evaluateDirective(ctx *Context, sig commands.Signature, cmd parser.NodeCommand) error {
+	handler, ok := directiveMap[sig.Name]
+	if !ok {
+		return fmt.Errorf("unknown directive: %s", sig.Name)
+	}
+	args, err := bindArgs(ctx, sig, cmd.Args)
+	if err != nil {
+		return err
+	}
+	return handler(ctx, args)
+}
+
 // evaluateCommand evaluates a command node
 func evaluateCommand(ctx *Context, cmd parser.NodeCommand, input *Stream) (*Stream, bool, error) {
-	if handler, ok := handlerMap[cmd.Name]; ok {
-		if ctx.debug {
-			log.Println("command: ", cmd)
-		}
-		return handler(ctx, input, cmd.Args)
+	handler, ok := handlerMap[cmd.Name]
+	sig, known := commands.Lookup(cmd.Name)
+	if known && sig.Directive {
+		return nil, false, fmt.Errorf("%s must be a statement of its own", cmd.Name)
+	}
+	if !ok || !known {
+		return nil, false, fmt.Errorf("unknown command: %s", cmd.Name)
+	}
+	if ctx.debug {
+		log.Println("command: ", cmd)
+	}
+	args, err := bindArgs(ctx, sig, cmd.Args)
+	if err != nil {
+		return nil, false, err
 	}
-	return nil, false, fmt.Errorf("unknown command: %s", cmd.Name)
+	return handler(ctx, input, args)
 }
 
-func applyCommandOnList(cmd cmdHandler, ctx *Context, input []*Stream, args []parser.NodeValue) ([]*Stream, bool, error) {
+func applyCommandOnList(cmd cmdHandler, ctx *Context, input []*Stream, args cmdArgs) ([]*Stream, bool, error) {
 
 	outpt := make([]*Stream, 0)
 
@@ -0,0 +1,320 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// Origin is the file a stream was opened from. It follows the stream
+// through the pipeline so outputs can be named after their sources.
+type Origin struct {
+	Path    string
+	ModTime time.Time
+	Created time.Time // creation date stored in the file, zero when unknown
+
+	// Sequence is set for image sequences, Path is then the first frame
+	Sequence bool
+}
+
+// Name is the file name without directory and extension, the directory
+// name for image sequences
+func (o *Origin) Name() string {
+	if o.Sequence {
+		return filepath.Base(filepath.Dir(o.Path))
+	}
+	base := filepath.Base(o.Path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// Ext is the extension of the file, with the dot
+func (o *Origin) Ext() string {
+	return filepath.Ext(o.Path)
+}
+
+// Date is the creation date stored in the file, the file is probed the
+// first time, or its modification time when it has none
+func (o *Origin) Date() time.Time {
+	if o.Created.IsZero() {
+		o.Created = creationTime(o.Path)
+	}
+	if o.Created.IsZero() {
+		return o.ModTime
+	}
+	return o.Created
+}
+
+// mediaTypes are the extensions open picks up from directories and globs,
+// by group. Without an ext argument video and audio files are opened.
+var mediaTypes = map[string][]string{
+	"video": {".mp4", ".mkv", ".mov", ".webm", ".avi", ".mts", ".m2ts"},
+	"audio": {".mp3", ".wav", ".flac", ".aac", ".m4a", ".ogg", ".opus"},
+	"image": {".jpg", ".jpeg", ".png", ".bmp", ".tif", ".tiff", ".webp"},
+}
+
+const defaultMediaTypes = "video,audio"
+
+// extensionSet parses the ext argument of open: a comma separated list of
+// groups from mediaTypes and extensions, such as "video,gif"
+func extensionSet(spec string) (map[string]bool, error) {
+	if spec == "" {
+		spec = defaultMediaTypes
+	}
+	set := make(map[string]bool)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if part == "" {
+			continue
+		}
+		if group, ok := mediaTypes[part]; ok {
+			for _, ext := range group {
+				set[ext] = true
+			}
+			continue
+		}
+		if strings.ContainsAny(part, `/\*?[`) {
+			return nil, fmt.Errorf("invalid extension %q", part)
+		}
+		set["."+strings.TrimPrefix(part, ".")] = true
+	}
+	if len(set) == 0 {
+		return nil, fmt.Errorf("no extensions in %q", spec)
+	}
+	return set, nil
+}
+
+// isGlob reports whether an open path is a pattern
+func isGlob(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// globFiles returns the files matching pattern. Besides the patterns of
+// filepath.Match, a ** segment matches any number of directories.
+func globFiles(pattern string) ([]string, error) {
+	segs := strings.Split(filepath.ToSlash(pattern), "/")
+	base := make([]string, 0, len(segs))
+	for len(segs) > 0 && !isGlob(segs[0]) {
+		base = append(base, segs[0])
+		segs = segs[1:]
+	}
+	root := filepath.FromSlash(strings.Join(base, "/"))
+	if root == "" {
+		root = "."
+	}
+	if len(base) == 1 && base[0] == "" {
+		root = "/"
+	}
+	for _, seg := range segs {
+		if _, err := filepath.Match(seg, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %v", pattern, err)
+		}
+	}
+
+	matches := make([]string, 0)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path != root && errors.Is(err, fs.ErrPermission) {
+				// a directory that can't be read has nothing to open
+				return skipEntry(d)
+			}
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		relSegs := strings.Split(filepath.ToSlash(rel), "/")
+		if d.IsDir() {
+			if path != root && !dirMayMatch(segs, relSegs) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if matchSegments(segs, relSegs) {
+			matches = append(matches, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %v", err)
+	}
+	return matches, nil
+}
+
+// skipEntry skips a directory, or only the entry when it is a file
+func skipEntry(d fs.DirEntry) error {
+	if d != nil && d.IsDir() {
+		return fs.SkipDir
+	}
+	return nil
+}
+
+// dirMayMatch reports whether files under a directory, given by its path
+// segments, can match the pattern segments
+func dirMayMatch(pattern, dir []string) bool {
+	for len(dir) > 0 {
+		if len(pattern) > 0 && pattern[0] == "**" {
+			return true
+		}
+		// the last segment is matched against file names
+		if len(pattern) < 2 {
+			return false
+		}
+		if ok, _ := filepath.Match(pattern[0], dir[0]); !ok {
+			return false
+		}
+		pattern, dir = pattern[1:], dir[1:]
+	}
+	return true
+}
+
+func matchSegments(pattern, path []string) bool {
+	if len(pattern) == 0 {
+		return len(path) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(path); i++ {
+			if matchSegments(pattern[1:], path[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(path) == 0 {
+		return false
+	}
+	ok, _ := filepath.Match(pattern[0], path[0])
+	return ok && matchSegments(pattern[1:], path[1:])
+}
+
+// dirFiles lists the files of a directory, without its subdirectories
+func dirFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %v", err)
+	}
+	files := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return files, nil
+}
+
+// openFiles opens the files with an extension from exts, ordered by
+// sortBy: "name" in natural order, "mtime" or "created"
+func openFiles(ctx *Context, files []string, exts map[string]bool, sortBy string) ([]*Stream, error) {
+	origins := make([]*Origin, 0, len(files))
+	for _, path := range files {
+		if !exts[strings.ToLower(filepath.Ext(path))] {
+			continue
+		}
+		origin, err := newOrigin(path, sortBy == "created")
+		if err != nil {
+			return nil, err
+		}
+		origins = append(origins, origin)
+	}
+
+	sortOrigins(origins, sortBy)
+
+	streams := make([]*Stream, 0, len(origins))
+	for _, origin := range origins {
+		media, _ := probeFile(origin.Path)
+		streams = append(streams, &Stream{FFStream: ffmpeg.Input(origin.Path), Origin: origin, Media: media})
+		if ctx.debug {
+			fmt.Printf("Opened file: %s\n", origin.Path)
+		}
+	}
+	return streams, nil
+}
+
+// newOrigin describes a file, probing it for its creation date if asked
+func newOrigin(path string, created bool) (*Origin, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	origin := &Origin{Path: path, ModTime: info.ModTime()}
+	if created {
+		origin.Created = creationTime(path)
+	}
+	return origin, nil
+}
+
+func sortOrigins(origins []*Origin, sortBy string) {
+	sort.SliceStable(origins, func(i, j int) bool {
+		a, b := origins[i], origins[j]
+		switch sortBy {
+		case "mtime":
+			if !a.ModTime.Equal(b.ModTime) {
+				return a.ModTime.Before(b.ModTime)
+			}
+		case "created":
+			ta, tb := a.Created, b.Created
+			if ta.IsZero() {
+				ta = a.ModTime
+			}
+			if tb.IsZero() {
+				tb = b.ModTime
+			}
+			if !ta.Equal(tb) {
+				return ta.Before(tb)
+			}
+		}
+		return naturalLess(a.Path, b.Path)
+	})
+}
+
+// naturalLess compares strings with runs of digits compared by value, so
+// clip2 comes before clip10
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		da, db := digitPrefix(a), digitPrefix(b)
+		if da != "" && db != "" {
+			na, nb := strings.TrimLeft(da, "0"), strings.TrimLeft(db, "0")
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+			if len(da) != len(db) {
+				return len(da) < len(db)
+			}
+			a, b = a[len(da):], b[len(db):]
+			continue
+		}
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+func digitPrefix(s string) string {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return s[:i]
+}
+
+// creationTime reads the creation date cameras store in the container,
+// zero when the file has none or can't be probed
+func creationTime(path string) time.Time {
+	info, err := probeFile(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.Created
+}
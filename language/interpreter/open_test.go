@@ -0,0 +1,117 @@
+package interpreter
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestMatchSegments(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"*.mp4", "a.mp4", true},
+		{"*.mp4", "a.mov", false},
+		{"*.mp4", "day1/a.mp4", false},
+		{"day*/*.mp4", "day1/a.mp4", true},
+		{"day*/*.mp4", "night/a.mp4", false},
+		{"day*/*.mp4", "day1/x/a.mp4", false},
+		{"**/*.mp4", "a.mp4", true},
+		{"**/*.mp4", "day1/x/a.mp4", true},
+		{"day1/**/take?.mp4", "day1/take1.mp4", true},
+		{"day1/**/take?.mp4", "day1/a/b/take2.mp4", true},
+		{"day1/**/take?.mp4", "day2/a/take2.mp4", false},
+		{"day1/**", "day1/a/b.mp4", true},
+		{"[ab].mp4", "c.mp4", false},
+	}
+	for _, tt := range tests {
+		got := matchSegments(strings.Split(tt.pattern, "/"), strings.Split(tt.path, "/"))
+		if got != tt.want {
+			t.Errorf("matchSegments(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestDirMayMatch(t *testing.T) {
+	tests := []struct {
+		pattern, dir string
+		want         bool
+	}{
+		{"*.mp4", "day1", false},
+		{"day*/*.mp4", "day1", true},
+		{"day*/*.mp4", "night", false},
+		{"day*/*.mp4", "day1/x", false},
+		{"**/*.mp4", "a/b/c", true},
+		{"day1/**/*.mp4", "day1/a/b", true},
+		{"day1/**/*.mp4", "day2", false},
+	}
+	for _, tt := range tests {
+		got := dirMayMatch(strings.Split(tt.pattern, "/"), strings.Split(tt.dir, "/"))
+		if got != tt.want {
+			t.Errorf("dirMayMatch(%q, %q) = %v, want %v", tt.pattern, tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestGlobFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.mp4", "b.mov", "day1/c.mp4", "day1/deep/d.mp4", "night/e.mp4"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"*.mp4", []string{"a.mp4"}},
+		{"day*/*.mp4", []string{"day1/c.mp4"}},
+		{"**/*.mp4", []string{"a.mp4", "day1/c.mp4", "day1/deep/d.mp4", "night/e.mp4"}},
+	}
+	for _, tt := range tests {
+		files, err := globFiles(filepath.Join(dir, tt.pattern))
+		if err != nil {
+			t.Fatalf("globFiles(%q): %v", tt.pattern, err)
+		}
+		got := make([]string, 0, len(files))
+		for _, f := range files {
+			rel, _ := filepath.Rel(dir, f)
+			got = append(got, filepath.ToSlash(rel))
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("globFiles(%q) = %v, want %v", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestNaturalLess(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"clip2.mp4", "clip10.mp4", true},
+		{"clip10.mp4", "clip2.mp4", false},
+		{"clip02.mp4", "clip2.mp4", false},
+		{"clip2.mp4", "clip02.mp4", true},
+		{"a.mp4", "b.mp4", true},
+		{"take1", "take1b", true},
+		{"take1b", "take1", false},
+		{"same", "same", false},
+		{"v9s5", "v9s10", true},
+	}
+	for _, tt := range tests {
+		if got := naturalLess(tt.a, tt.b); got != tt.want {
+			t.Errorf("naturalLess(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
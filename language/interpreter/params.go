@@ -0,0 +1,63 @@
+package interpreter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/andyp1xe1/vidlang/language/parser"
+)
+
+// argsName is the list holding the positional command line arguments
+const argsName parser.NodeIdent = "args"
+
+// scriptGlobals returns the values a script gets from the command line:
+// every -var by name and the positional arguments as the list args. Types
+// are inferred the way parser.ParseLiteral reads them.
+func scriptGlobals(opts Options) (map[parser.NodeIdent]ValueBox, error) {
+	globals := make(map[parser.NodeIdent]ValueBox, len(opts.Vars)+1)
+	for name, raw := range opts.Vars {
+		if !parser.IsIdentifier(name) || parser.NodeIdent(name) == argsName {
+			return nil, fmt.Errorf("-var %s: invalid variable name", name)
+		}
+		v, err := parser.ParseLiteral(raw)
+		if err != nil {
+			return nil, fmt.Errorf("-var %s: %v", name, err)
+		}
+		globals[parser.NodeIdent(name)] = literalToBox(v)
+	}
+
+	items := make([]ValueBox, 0, len(opts.Args))
+	for i, raw := range opts.Args {
+		v, err := parser.ParseLiteral(raw)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %v", i, err)
+		}
+		items = append(items, literalToBox(v))
+	}
+	globals[argsName] = ValueBox{items, ValueList}
+	return globals, nil
+}
+
+// VarFlags collects repeated -var name=value flags for Options.Vars, it is
+// a flag.Value
+type VarFlags map[string]string
+
+func (v VarFlags) String() string {
+	pairs := make([]string, 0, len(v))
+	for name, value := range v {
+		pairs = append(pairs, name+"="+value)
+	}
+	return strings.Join(pairs, " ")
+}
+
+func (v VarFlags) Set(s string) error {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok {
+		return fmt.Errorf("expected name=value, got %q", s)
+	}
+	if !parser.IsIdentifier(name) {
+		return fmt.Errorf("invalid variable name %q", name)
+	}
+	v[name] = value
+	return nil
+}
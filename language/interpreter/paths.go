@@ -0,0 +1,38 @@
+package interpreter
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// resolvePath resolves a path given to open or export. A leading ~ is the
+// home directory, relative paths are taken from the -root directory when
+// set, else from the directory of the running script, else from the
+// working directory, for stdin
+func (c *Context) resolvePath(path string) string {
+	path = expandHome(path)
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	switch {
+	case c.root != "":
+		return filepath.Join(c.root, path)
+	case c.file != "":
+		return filepath.Join(filepath.Dir(c.file), path)
+	}
+	return filepath.Clean(path)
+}
+
+// expandHome replaces a leading ~ with the home directory, ~user is left
+// as is
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
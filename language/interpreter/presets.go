@@ -0,0 +1,134 @@
+package interpreter
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/andyp1xe1/vidlang/language/commands"
+)
+
+// Preset is a named set of export settings, selected with preset=.
+// Arguments given to export win over the preset.
+type Preset struct {
+	Canvas    Canvas   `json:"canvas"`
+	VCodec    string   `json:"vcodec"`
+	ACodec    string   `json:"acodec"`
+	CRF       *float64 `json:"crf"`
+	Bitrate   string   `json:"bitrate"`
+	ABitrate  string   `json:"abitrate"`
+	Speed     string   `json:"speed"`
+	Profile   string   `json:"profile"`
+	Format    string   `json:"format"`
+	Faststart bool     `json:"faststart"`
+}
+
+func crf(v float64) *float64 { return &v }
+
+var builtinPresets = map[string]Preset{
+	"web": {
+		Canvas: Canvas{Width: 1920, Height: 1080, FPS: 30},
+		VCodec: "libx264", CRF: crf(23), Speed: "medium", Profile: "high",
+		ACodec: "aac", ABitrate: "128k", Faststart: true,
+	},
+	"archive": {
+		VCodec: "libx265", CRF: crf(16), Speed: "slow",
+		ACodec: "aac", ABitrate: "320k",
+	},
+	"prores": {
+		VCodec: "prores_ks", Profile: "hq",
+		ACodec: "pcm_s16le",
+	},
+	"social-vertical": {
+		Canvas: Canvas{Width: 1080, Height: 1920, FPS: 30},
+		VCodec: "libx264", Bitrate: "8M", Speed: "medium", Profile: "high",
+		ACodec: "aac", ABitrate: "192k", Faststart: true,
+	},
+	"gif": {
+		Canvas: Canvas{Width: 480, FPS: 15},
+		VCodec: "gif", Format: "gif",
+	},
+}
+
+// encoding returns the encoder settings of the preset
+func (p Preset) encoding() encoding {
+	e := encoding{
+		vcodec:    p.VCodec,
+		acodec:    p.ACodec,
+		crf:       -1,
+		bitrate:   p.Bitrate,
+		abitrate:  p.ABitrate,
+		speed:     p.Speed,
+		profile:   p.Profile,
+		format:    p.Format,
+		faststart: p.Faststart,
+	}
+	if p.CRF != nil {
+		e.crf = *p.CRF
+	}
+	return e
+}
+
+// check rejects codecs and formats export doesn't know, the rest is
+// validated when the preset is used
+func (p Preset) check() error {
+	for _, name := range []string{p.VCodec, p.ACodec} {
+		if _, ok := commands.Encoders[name]; !ok && name != "" && name != "copy" {
+			return fmt.Errorf("unknown encoder %q", name)
+		}
+	}
+	if _, ok := commands.Containers[p.Format]; !ok && p.Format != "" {
+		return fmt.Errorf("unknown format %q", p.Format)
+	}
+	return nil
+}
+
+// presetTable returns the builtin presets together with the user ones,
+// which replace builtin presets of the same name
+func presetTable(user map[string]Preset) map[string]Preset {
+	presets := make(map[string]Preset, len(builtinPresets)+len(user))
+	for name, p := range builtinPresets {
+		presets[name] = p
+	}
+	for name, p := range user {
+		presets[name] = p
+	}
+	return presets
+}
+
+// preset looks up a preset by name, the empty name is no preset
+func (c *Context) preset(name string) (Preset, error) {
+	return lookupPreset(c.presets, name)
+}
+
+// lookupPreset finds a preset in a table, a name that is an encoder speed
+// is most likely meant for speed=
+func lookupPreset(presets map[string]Preset, name string) (Preset, error) {
+	if name == "" {
+		return Preset{}, nil
+	}
+	p, ok := presets[name]
+	if ok {
+		return p, nil
+	}
+	if isSpeed(name) {
+		return p, fmt.Errorf("unknown preset %q, the encoder speed is set with speed=%q", name, name)
+	}
+	names := make([]string, 0, len(presets))
+	for n := range presets {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return p, fmt.Errorf("unknown preset %q, known presets are %s", name, strings.Join(names, ", "))
+}
+
+// isSpeed reports whether an encoder takes name as a speed preset
+func isSpeed(name string) bool {
+	for _, enc := range commands.Encoders {
+		if slices.Contains(enc.Speeds, name) {
+			return true
+		}
+	}
+	return false
+}
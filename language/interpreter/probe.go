@@ -0,0 +1,214 @@
+package interpreter
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// MediaInfo is what ffprobe tells about a stream. Commands that change
+// the duration or the frame size keep it up to date for their output.
+type MediaInfo struct {
+	Duration float64 // seconds, 0 when unknown
+	Width    int
+	Height   int
+	FPS      float64
+	HasVideo bool
+	HasAudio bool
+	Created  time.Time // creation date stored in the file, zero when unknown
+}
+
+type probeEntry struct {
+	modTime time.Time
+	info    *MediaInfo
+	err     error
+}
+
+// probeCache holds the result of probing each file, by path, until the
+// file is modified
+var probeCache = struct {
+	sync.Mutex
+	entries map[string]probeEntry
+}{entries: make(map[string]probeEntry)}
+
+// probeFile runs ffprobe on a file, once for each version of the file
+func probeFile(path string) (*MediaInfo, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	probeCache.Lock()
+	defer probeCache.Unlock()
+	if e, ok := probeCache.entries[path]; ok && e.modTime.Equal(stat.ModTime()) {
+		return e.info, e.err
+	}
+
+	info, err := runProbe(path)
+	if err != nil {
+		err = fmt.Errorf("cannot probe %s: %v", path, err)
+	}
+	probeCache.entries[path] = probeEntry{stat.ModTime(), info, err}
+	return info, err
+}
+
+type probeOutput struct {
+	Streams []struct {
+		CodecType    string `json:"codec_type"`
+		Width        int    `json:"width"`
+		Height       int    `json:"height"`
+		AvgFrameRate string `json:"avg_frame_rate"`
+		RFrameRate   string `json:"r_frame_rate"`
+		Duration     string `json:"duration"`
+	} `json:"streams"`
+	Format struct {
+		Duration string            `json:"duration"`
+		Tags     map[string]string `json:"tags"`
+	} `json:"format"`
+}
+
+func runProbe(path string) (*MediaInfo, error) {
+	out, err := ffmpeg.Probe(path)
+	if err != nil {
+		return nil, err
+	}
+	var probe probeOutput
+	if err := json.Unmarshal([]byte(out), &probe); err != nil {
+		return nil, fmt.Errorf("invalid ffprobe output: %v", err)
+	}
+
+	info := &MediaInfo{}
+	info.Duration, _ = strconv.ParseFloat(probe.Format.Duration, 64)
+	if t, err := time.Parse(time.RFC3339Nano, probe.Format.Tags["creation_time"]); err == nil {
+		info.Created = t
+	}
+	for _, s := range probe.Streams {
+		switch s.CodecType {
+		case "video":
+			if info.HasVideo {
+				continue
+			}
+			info.HasVideo = true
+			info.Width, info.Height = s.Width, s.Height
+			info.FPS = parseFrameRate(s.AvgFrameRate)
+			if info.FPS == 0 {
+				info.FPS = parseFrameRate(s.RFrameRate)
+			}
+		case "audio":
+			info.HasAudio = true
+		}
+		if info.Duration == 0 {
+			info.Duration, _ = strconv.ParseFloat(s.Duration, 64)
+		}
+	}
+	return info, nil
+}
+
+// parseFrameRate reads rates such as 30000/1001, 0 when there is none
+func parseFrameRate(s string) float64 {
+	num, den, ok := strings.Cut(s, "/")
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0
+	}
+	if !ok {
+		return n
+	}
+	d, err := strconv.ParseFloat(den, 64)
+	if err != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
+
+// mediaInfo returns what is known about a stream. An unedited stream
+// whose file could not be probed when it was opened is probed again, and
+// keeps the result; the probe error is returned when it fails again.
+func mediaInfo(s *Stream) (*MediaInfo, error) {
+	if s.Media != nil {
+		return s.Media, nil
+	}
+	if s.Origin != nil && !s.Edited {
+		info, err := probeFile(s.Origin.Path)
+		if err != nil {
+			return nil, err
+		}
+		s.Media = info
+		return info, nil
+	}
+	return nil, fmt.Errorf("the media info of the stream is unknown")
+}
+
+// withMedia returns a copy of info changed by update, nil stays nil
+func withMedia(info *MediaInfo, update func(*MediaInfo)) *MediaInfo {
+	if info == nil {
+		return nil
+	}
+	res := *info
+	update(&res)
+	return &res
+}
+
+// withoutAudio returns the info of the video of a stream, audio only info
+// and nil are kept
+func withoutAudio(info *MediaInfo) *MediaInfo {
+	if info == nil || !info.HasAudio || !info.HasVideo {
+		return info
+	}
+	return withMedia(info, func(m *MediaInfo) { m.HasAudio = false })
+}
+
+// knownDurations returns the duration of each stream, ok is false when
+// one of them is unknown
+func knownDurations(infos []*MediaInfo) ([]float64, bool) {
+	res := make([]float64, 0, len(infos))
+	for _, info := range infos {
+		if info == nil || info.Duration == 0 {
+			return nil, false
+		}
+		res = append(res, info.Duration)
+	}
+	return res, true
+}
+
+// stackedMedia is the info of streams stacked by cmdStack: scaled to the
+// canvas height side by side (h) or to the canvas width on top of each
+// other (v), lasting as long as the longest one
+func stackedMedia(infos []*MediaInfo, direction string, c Canvas) *MediaInfo {
+	media := &MediaInfo{HasVideo: true}
+	if durations, ok := knownDurations(infos); ok {
+		for _, d := range durations {
+			media.Duration = math.Max(media.Duration, d)
+		}
+	}
+	if direction == "h" {
+		media.Height = c.Height
+	} else {
+		media.Width = c.Width
+	}
+	for _, info := range infos {
+		if info == nil || info.Width == 0 || info.Height == 0 {
+			return media
+		}
+	}
+	for _, info := range infos {
+		if direction == "h" {
+			media.Width += evenRound(float64(info.Width) * float64(c.Height) / float64(info.Height))
+		} else {
+			media.Height += evenRound(float64(info.Height) * float64(c.Width) / float64(info.Width))
+		}
+	}
+	return media
+}
+
+// evenRound rounds a size the way a -2 in ffmpeg's scale filter does
+func evenRound(v float64) int {
+	return int(math.Round(v/2)) * 2
+}
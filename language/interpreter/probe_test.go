@@ -0,0 +1,102 @@
+package interpreter
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andyp1xe1/vidlang/language/parser"
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// fakeProbe makes probeFile return info for a new empty file, without
+// running ffprobe
+func fakeProbe(t *testing.T, info *MediaInfo) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "in.mp4")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	probeCache.Lock()
+	probeCache.entries[path] = probeEntry{modTime: stat.ModTime(), info: info}
+	probeCache.Unlock()
+	return path
+}
+
+func TestMediaInfoProbesAgain(t *testing.T) {
+	want := &MediaInfo{Duration: 12, Width: 640, Height: 360, HasVideo: true}
+	path := fakeProbe(t, want)
+
+	input := ffmpeg.Input(path)
+	tests := []struct {
+		name   string
+		stream *Stream
+		ok     bool
+	}{
+		{"opened", &Stream{FFStream: input}, true},
+		{"split", newSplitNode(&Stream{FFStream: input}).split(0).(*Stream), true},
+		{"edited", &Stream{FFStream: input.HFlip(), Edited: true}, false},
+		{"edited and split", newSplitNode(&Stream{FFStream: input.HFlip(), Edited: true}).split(0).(*Stream), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.stream.Origin = &Origin{Path: path}
+			got, err := mediaInfo(tt.stream)
+			if !tt.ok {
+				if err == nil {
+					t.Errorf("mediaInfo of an edited stream = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("mediaInfo: %v", err)
+			}
+			if got != want || tt.stream.Media != want {
+				t.Errorf("mediaInfo = %+v, stream keeps %+v, want %+v", got, tt.stream.Media, want)
+			}
+		})
+	}
+}
+
+func TestFilterOutputHasNoAudio(t *testing.T) {
+	media := &MediaInfo{Duration: 10, HasVideo: true, HasAudio: true}
+	input := &Stream{FFStream: ffmpeg.Input("in.mp4"), Media: media}
+	cut := parser.NodeCommand{Name: "cut", Args: []parser.NodeValue{parser.NodeLiteralNumber(0), parser.NodeLiteralNumber(5)}}
+
+	out, _, err := evaluatePipelineThread(NewContext(false, false), parser.NodePipeline{cut}, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Media.HasAudio || out.Media.Duration != 5 {
+		t.Errorf("cut gives %+v, want 5s without audio", out.Media)
+	}
+	if !media.HasAudio {
+		t.Errorf("the info of the input was changed")
+	}
+}
+
+func TestExtractAudioOfEdit(t *testing.T) {
+	media := &MediaInfo{Duration: 10, HasVideo: true, HasAudio: true}
+	input := &Stream{FFStream: ffmpeg.Input("in.mp4"), Media: media}
+	cut := parser.NodeCommand{Name: "cut", Args: []parser.NodeValue{parser.NodeLiteralNumber(0), parser.NodeLiteralNumber(5)}}
+	extract := parser.NodeCommand{Name: "extractaudio"}
+
+	out, _, err := evaluatePipelineThread(NewContext(false, false), parser.NodePipeline{extract}, input)
+	if err != nil {
+		t.Fatalf("extractaudio of an opened clip: %v", err)
+	}
+	if !out.Media.HasAudio || out.Media.HasVideo {
+		t.Errorf("extractaudio gives %+v, want audio only", out.Media)
+	}
+	// without media info only the edit tells the audio is gone
+	unknown := &Stream{FFStream: ffmpeg.Input("in.mp4")}
+	_, _, err = evaluatePipelineThread(NewContext(false, false), parser.NodePipeline{cut, extract}, unknown)
+	if err == nil || !strings.Contains(err.Error(), "straight from open") {
+		t.Errorf("extractaudio of a cut clip = %v, want an error", err)
+	}
+}
@@ -0,0 +1,145 @@
+package interpreter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// framePattern is the frame number of an image sequence path, such as
+// %04d in frames/%04d.png
+var framePattern = regexp.MustCompile(`%(0[0-9]+)?d`)
+
+// isFramePattern reports whether the file name of path numbers frames
+func isFramePattern(path string) bool {
+	return framePattern.MatchString(filepath.Base(path))
+}
+
+// isImageGlob reports whether pattern picks image files by extension,
+// such as dir/*.jpg, which open reads as one sequence
+func isImageGlob(pattern string) bool {
+	if !isGlob(filepath.Base(pattern)) {
+		return false
+	}
+	ext := strings.ToLower(filepath.Ext(pattern))
+	for _, e := range mediaTypes["image"] {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// frameFiles returns the files of a numbered sequence, in frame order,
+// and the number of the first frame
+func frameFiles(pattern string) ([]string, int, error) {
+	dir, base := filepath.Split(pattern)
+	if dir == "" {
+		dir = "."
+	}
+	var expr strings.Builder
+	expr.WriteString("^")
+	last := 0
+	for _, m := range framePattern.FindAllStringSubmatchIndex(base, -1) {
+		expr.WriteString(regexp.QuoteMeta(base[last:m[0]]))
+		if m[2] >= 0 {
+			width, _ := strconv.Atoi(base[m[2]:m[3]])
+			fmt.Fprintf(&expr, "([0-9]{%d,})", width)
+		} else {
+			expr.WriteString("([0-9]+)")
+		}
+		last = m[1]
+	}
+	expr.WriteString(regexp.QuoteMeta(base[last:]) + "$")
+	re := regexp.MustCompile(expr.String())
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read directory: %v", err)
+	}
+	type frame struct {
+		path string
+		n    int
+	}
+	frames := make([]frame, 0)
+	for _, e := range entries {
+		m := re.FindStringSubmatch(e.Name())
+		if m == nil || e.IsDir() {
+			continue
+		}
+		n, _ := strconv.Atoi(m[1])
+		frames = append(frames, frame{filepath.Join(dir, e.Name()), n})
+	}
+	if len(frames) == 0 {
+		return nil, 0, fmt.Errorf("no frames match %s", pattern)
+	}
+	sort.Slice(frames, func(i, j int) bool { return frames[i].n < frames[j].n })
+	files := make([]string, 0, len(frames))
+	for _, f := range frames {
+		files = append(files, f.path)
+	}
+	return files, frames[0].n, nil
+}
+
+// openSequence opens a numbered sequence or a glob of stills as one
+// stream at the given frame rate. Globs are read in name order.
+func openSequence(path string, fps float64) (*Stream, error) {
+	var files []string
+	kw := ffmpeg.KwArgs{"framerate": fmt.Sprintf("%v", fps)}
+	if isFramePattern(path) {
+		var start int
+		var err error
+		files, start, err = frameFiles(path)
+		if err != nil {
+			return nil, err
+		}
+		kw["start_number"] = strconv.Itoa(start)
+	} else {
+		if strings.Contains(path, "**") {
+			return nil, fmt.Errorf("image sequences can't use **, got %s", path)
+		}
+		var err error
+		files, err = globFiles(path)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("no images match %s", path)
+		}
+		kw["pattern_type"] = "glob"
+	}
+
+	first, err := os.Stat(files[0])
+	if err != nil {
+		return nil, err
+	}
+	media := &MediaInfo{
+		Duration: float64(len(files)) / fps,
+		FPS:      fps,
+		HasVideo: true,
+	}
+	if info, err := probeFile(files[0]); err == nil {
+		media.Width, media.Height = info.Width, info.Height
+	}
+	return &Stream{
+		FFStream: ffmpeg.Input(path, kw),
+		Origin:   &Origin{Path: files[0], ModTime: first.ModTime(), Sequence: true},
+		Media:    media,
+	}, nil
+}
+
+// imageEncoders are the encoders frames are written with, by extension
+var imageEncoders = map[string]string{
+	".png":  "png",
+	".jpg":  "mjpeg",
+	".jpeg": "mjpeg",
+	".tif":  "tiff",
+	".tiff": "tiff",
+	".bmp":  "bmp",
+}
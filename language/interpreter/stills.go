@@ -0,0 +1,42 @@
+package interpreter
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/andyp1xe1/vidlang/language/commands"
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// imageArgs are the output options writing a single image to path, the
+// encoder follows its extension
+func imageArgs(path string) (ffmpeg.KwArgs, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	vcodec, ok := imageEncoders[ext]
+	if !ok {
+		return nil, fmt.Errorf("can't write images as %s, use png, jpg, tif or bmp", ext)
+	}
+	kw := ffmpeg.KwArgs{
+		"c:v":      vcodec,
+		"pix_fmt":  commands.Encoders[vcodec].PixFmts[0],
+		"f":        "image2",
+		"update":   "1",
+		"frames:v": "1",
+		"an":       "",
+		"y":        "",
+	}
+	if vcodec == "mjpeg" {
+		kw["q:v"] = "2"
+	}
+	return kw, nil
+}
+
+// writeImage runs a short ffmpeg of its own for an image, apart from
+// any export of the stream
+func writeImage(stream *ffmpeg.Stream, path string, kw ffmpeg.KwArgs) error {
+	if err := makeOutputDir(path); err != nil {
+		return err
+	}
+	return runOutput(stream.Output(path, kw))
+}
@@ -15,17 +15,35 @@ const (
 // Stream represents a media stream in our DSL
 type Stream struct {
 	FFStream *ffmpeg.Stream
+	Origin   *Origin    // file the stream comes from, nil when it has none
+	Media    *MediaInfo // probed info, nil when unknown
+	Edited   bool       // went through a command, the file no longer describes it
 }
 
 type StreamList []*Stream
 
 type SplitNode struct {
 	*ffmpeg.Node
+	origin *Origin
+	media  *MediaInfo
+	edited bool
+}
+
+// newSplitNode splits a stream so it can be used more than once, audio
+// only streams with asplit
+func newSplitNode(s *Stream) *SplitNode {
+	if s.Media != nil && s.Media.HasAudio && !s.Media.HasVideo {
+		return &SplitNode{s.FFStream.ASplit(), s.Origin, s.Media, s.Edited}
+	}
+	return &SplitNode{s.FFStream.Split(), s.Origin, s.Media, s.Edited}
 }
 
 func (n *SplitNode) split(c int) interface{} {
 	return &Stream{
 		FFStream: n.Get(fmt.Sprintf("%v", c)),
+		Origin:   n.origin,
+		Media:    n.media,
+		Edited:   n.edited,
 	}
 }
 
@@ -47,14 +65,55 @@ type storeNode interface{ split(c int) interface{} }
 type streamStore struct {
 	splitNodes     map[parser.NodeIdent]storeNode
 	canCopyStreams map[parser.NodeIdent]interface{}
-	splitCounts    map[parser.NodeIdent]int
+	splitCounts    map[parser.NodeIdent]*int // outputs taken from each split node, shared by the stores holding it
 }
 
 func newStreamStore() streamStore {
 	return streamStore{
 		splitNodes:     make(map[parser.NodeIdent]storeNode),
 		canCopyStreams: make(map[parser.NodeIdent]interface{}),
-		splitCounts:    make(map[parser.NodeIdent]int),
+		splitCounts:    make(map[parser.NodeIdent]*int),
+	}
+}
+
+func (s streamStore) has(name parser.NodeIdent) bool {
+	_, split := s.splitNodes[name]
+	_, cp := s.canCopyStreams[name]
+	return split || cp
+}
+
+func (s streamStore) remove(name parser.NodeIdent) {
+	delete(s.splitNodes, name)
+	delete(s.canCopyStreams, name)
+	delete(s.splitCounts, name)
+}
+
+// names lists every stream in the store
+func (s streamStore) names() []parser.NodeIdent {
+	res := make([]parser.NodeIdent, 0, len(s.splitNodes))
+	for name := range s.splitNodes {
+		res = append(res, name)
+	}
+	for name := range s.canCopyStreams {
+		if _, ok := s.splitNodes[name]; !ok {
+			res = append(res, name)
+		}
+	}
+	return res
+}
+
+// shareWith makes a stream available in another store under a new name,
+// both stores take outputs of the same split node
+func (s streamStore) shareWith(dst streamStore, name, as parser.NodeIdent) {
+	dst.remove(as)
+	if entry, ok := s.canCopyStreams[name]; ok {
+		dst.canCopyStreams[as] = entry
+	}
+	if node, ok := s.splitNodes[name]; ok {
+		dst.splitNodes[as] = node
+	}
+	if count, ok := s.splitCounts[name]; ok {
+		dst.splitCounts[as] = count
 	}
 }
 
@@ -67,8 +126,8 @@ func (s streamStore) getAuto(name parser.NodeIdent) (interface{}, bool, error) {
 	if err != nil {
 		return nil, false, err
 	}
-	fmt.Printf("split count: %v\n", s.splitCounts[name])
-	s.splitCounts[name] = s.splitCounts[name] + 1
+	fmt.Printf("split count: %v\n", *s.splitCounts[name])
+	*s.splitCounts[name]++
 	return stream, false, nil
 
 }
@@ -78,29 +137,36 @@ func (s streamStore) getSplit(name parser.NodeIdent) (interface{}, error) {
 	if !ok {
 		return nil, fmt.Errorf("stream variable %s not defined", name)
 	}
-	stream := fnode.split(s.splitCounts[name])
-	s.splitCounts[name] = s.splitCounts[name] + 1
+	count := s.splitCounts[name]
+	stream := fnode.split(*count)
+	*count++
 	return stream, nil
 }
 
 func (s streamStore) set(name parser.NodeIdent, entry interface{}, canCopy bool) {
 	if canCopy {
 		s.canCopyStreams[name] = entry
+	} else {
+		delete(s.canCopyStreams, name)
 	}
 
-	if stream, ok := entry.(*Stream); ok {
-		s.splitNodes[name] = &SplitNode{stream.FFStream.Split()}
+	if stream, ok := entry.(*Stream); ok && stream.FFStream != nil {
+		s.splitNodes[name] = newSplitNode(stream)
 
 	} else if list, ok := entry.(StreamList); ok {
 
 		spList := SplitList{make([]*SplitNode, 0)}
 
 		for _, s := range []*Stream(list) {
-			spList.list = append(spList.list, &SplitNode{s.FFStream.Split()})
+			if s == nil || s.FFStream == nil {
+				// nothing to split, e.g. the result of a pipeline without input
+				continue
+			}
+			spList.list = append(spList.list, newSplitNode(s))
 		}
 
 		s.splitNodes[name] = &spList
 	}
 
-	s.splitCounts[name] = 0
+	s.splitCounts[name] = new(int)
 }
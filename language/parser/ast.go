@@ -5,6 +5,7 @@ import (
 	"strings"
 )
 
+// AstError is a lexical or syntax error, at a 1-based line and column
 type AstError struct {
 	Message string
 	Line    int
@@ -23,6 +24,14 @@ func NewAstError(message string, line, pos int) AstError {
 	}
 }
 
+// Pos records where a node starts in the source: the 1-based line and
+// column reported in errors, like AstError, and the byte offset.
+type Pos struct {
+	Line   int
+	Column int
+	Offset int
+}
+
 type ValueType int
 
 const (
@@ -37,6 +46,11 @@ const (
 	ValueExpr
 	ValueList
 	ValueSubExpr
+	ValueNamedArg
+	ValueInterpolation
+	ValueCond
+	ValueCall
+	ValueIndex
 )
 
 type NodeValue interface {
@@ -44,10 +58,34 @@ type NodeValue interface {
 	String() string
 }
 
+// NodeLiteralString holds the decoded value of a string literal
 type NodeLiteralString string
 
 func (s NodeLiteralString) ValueType() ValueType { return ValueLiteralString }
-func (s NodeLiteralString) String() string       { return string(s) }
+func (s NodeLiteralString) String() string       { return quoteString(string(s)) }
+
+// NodeInterpolation is a string literal with `${name}` references,
+// Parts alternates between literal text and identifiers
+type NodeInterpolation struct {
+	Parts []NodeValue
+}
+
+func (n NodeInterpolation) ValueType() ValueType { return ValueInterpolation }
+func (n NodeInterpolation) String() string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, part := range n.Parts {
+		switch p := part.(type) {
+		case NodeLiteralString:
+			quoted := p.String()
+			sb.WriteString(quoted[1 : len(quoted)-1])
+		default:
+			sb.WriteString("${" + p.String() + "}")
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
 
 type NodeLiteralNumber float64
 
@@ -70,6 +108,64 @@ type NodeIdent string
 func (n NodeIdent) ValueType() ValueType { return ValueIdentifier }
 func (n NodeIdent) String() string       { return string(n) }
 
+// NodeVar is an identifier used as a value, Name is the variable it
+// refers to
+type NodeVar struct {
+	Name NodeIdent
+	Pos  Pos
+}
+
+func (n NodeVar) ValueType() ValueType { return ValueIdentifier }
+func (n NodeVar) String() string       { return string(n.Name) }
+
+// VarName returns the variable a value refers to, ok is false when the
+// value is not an identifier
+func VarName(v NodeValue) (name NodeIdent, ok bool) {
+	switch n := v.(type) {
+	case NodeVar:
+		return n.Name, true
+	case NodeIdent:
+		return n, true
+	}
+	return "", false
+}
+
+// PosOf returns where a node starts, ok is false for nodes that don't
+// record it, such as literals
+func PosOf(n Node) (pos Pos, ok bool) {
+	switch n := n.(type) {
+	case NodeVar:
+		return n.Pos, true
+	case NodeSubExpr:
+		return n.Pos, true
+	case NodeNamedArg:
+		return n.Pos, true
+	case NodeExprMath:
+		return n.Pos, true
+	case NodeUnary:
+		return n.Pos, true
+	case NodeCond:
+		return n.Pos, true
+	case NodeCall:
+		return n.Pos, true
+	case NodeIndex:
+		return n.Pos, true
+	case NodeExpr:
+		return n.Pos, true
+	case NodeCommand:
+		return n.Pos, true
+	case NodeAssign:
+		return n.Pos, true
+	case NodeIf:
+		return n.Pos, true
+	case NodeFor:
+		return n.Pos, true
+	case NodeImport:
+		return n.Pos, true
+	}
+	return Pos{}, false
+}
+
 type NodeSelfStar struct{ self string }
 
 func (s NodeSelfStar) ValueType() ValueType { return ValueSelfStar }
@@ -78,6 +174,7 @@ func (s NodeSelfStar) String() string       { return s.self }
 type NodeSubExpr struct {
 	Body   NodeValue
 	Params NodeList[NodeIdent]
+	Pos    Pos
 }
 
 func (s NodeSubExpr) ValueType() ValueType { return ValueSubExpr }
@@ -89,6 +186,16 @@ func (s NodeSubExpr) String() string {
 	return fmt.Sprintf("[%s] -> %s", strings.Join(params, ", "), s.Body.String())
 }
 
+// NodeNamedArg is a `name=value` command argument
+type NodeNamedArg struct {
+	Name  string
+	Value NodeValue
+	Pos   Pos
+}
+
+func (n NodeNamedArg) ValueType() ValueType { return ValueNamedArg }
+func (n NodeNamedArg) String() string       { return fmt.Sprintf("%s=%s", n.Name, n.Value) }
+
 type OpType int
 
 const (
@@ -96,21 +203,163 @@ const (
 	OpDiv OpType = OpType(itemDiv)
 	OpMul OpType = OpType(itemMult)
 	OpSub OpType = OpType(itemMinus)
+
+	OpEq        OpType = OpType(itemEq)
+	OpNotEq     OpType = OpType(itemNotEq)
+	OpLess      OpType = OpType(itemLess)
+	OpLessEq    OpType = OpType(itemLessEq)
+	OpGreater   OpType = OpType(itemGreater)
+	OpGreaterEq OpType = OpType(itemGreaterEq)
+
+	OpAnd OpType = OpType(itemAnd)
+	OpOr  OpType = OpType(itemOr)
+	OpNot OpType = OpType(itemNot)
+
+	OpRange OpType = OpType(itemRange)
 )
 
+// IsComparison reports whether the operator compares its operands
+func (o OpType) IsComparison() bool {
+	switch o {
+	case OpEq, OpNotEq, OpLess, OpLessEq, OpGreater, OpGreaterEq:
+		return true
+	}
+	return false
+}
+
+// IsLogical reports whether the operator combines booleans
+func (o OpType) IsLogical() bool {
+	return o == OpAnd || o == OpOr || o == OpNot
+}
+
+func (o OpType) String() string { return itemType(o).String() }
+
 type NodeExprMath struct {
 	Left  NodeValue
 	Op    OpType
 	Right NodeValue
+	Pos   Pos
 }
 
 func (n NodeExprMath) ValueType() ValueType { return ValueExpr }
 func (n NodeExprMath) String() string {
-	return fmt.Sprintf("(%s %s %s)", n.Left.String(), itemType(n.Op).String(), n.Right.String())
+	return fmt.Sprintf("(%s %s %s)", n.Left.String(), n.Op, n.Right.String())
+}
+
+// NodeUnary is a prefix operation, only `not` for now since a negative
+// operand is stored as a subtraction from zero
+type NodeUnary struct {
+	Op      OpType
+	Operand NodeValue
+	Pos     Pos
+}
+
+func (n NodeUnary) ValueType() ValueType { return ValueExpr }
+func (n NodeUnary) String() string {
+	return fmt.Sprintf("(%s %s)", n.Op, n.Operand.String())
+}
+
+// NodeCond is the inline conditional `if cond then a else b`
+type NodeCond struct {
+	Cond NodeValue
+	Then NodeValue
+	Else NodeValue
+	Pos  Pos
+}
+
+func (n NodeCond) ValueType() ValueType { return ValueCond }
+func (n NodeCond) String() string {
+	return fmt.Sprintf("if %s then %s else %s", n.Cond, n.Then, n.Else)
+}
+
+// NodeCall is a call of a builtin function such as `env "HOME"`, it takes
+// as many arguments as the function has parameters
+type NodeCall struct {
+	Name string
+	Args []NodeValue
+	Pos  Pos
+}
+
+func (n NodeCall) ValueType() ValueType { return ValueCall }
+func (n NodeCall) String() string {
+	s := n.Name
+	for _, arg := range n.Args {
+		s += " " + arg.String()
+	}
+	return "(" + s + ")"
+}
+
+// NodeIndex is `target[index]`, an item of a list or a clip of a stream
+// variable. Negative indexes count from the end.
+type NodeIndex struct {
+	Target NodeValue
+	Index  NodeValue
+	Pos    Pos
+}
+
+func (n NodeIndex) ValueType() ValueType { return ValueIndex }
+func (n NodeIndex) String() string {
+	return fmt.Sprintf("%s[%s]", n.Target, n.Index)
 }
 
 type Node interface{}
 
+// NodeIf is an `if cond { ... } else { ... }` statement. An `else if`
+// chain is kept as a single NodeIf inside Else.
+type NodeIf struct {
+	Cond NodeValue
+	Then []Node
+	Else []Node
+	Pos  Pos
+}
+
+func (n NodeIf) String() string {
+	s := fmt.Sprintf("if %s %s", n.Cond, blockString(n.Then))
+	if n.Else != nil {
+		s += " else " + blockString(n.Else)
+	}
+	return s
+}
+
+// NodeImport is `import "path" as name`, the definitions of the imported
+// script are available as name.x. Without `as` the name is the base name
+// of the file.
+type NodeImport struct {
+	Path  string
+	Alias NodeIdent
+	Pos   Pos
+}
+
+func (n NodeImport) String() string {
+	return fmt.Sprintf("import %s as %s", quoteString(n.Path), n.Alias)
+}
+
+// NodeFor is a `for i, v in iter { ... }` loop, Index is empty when only
+// the value is named. The body gets a new scope on every iteration.
+type NodeFor struct {
+	Index NodeIdent
+	Value NodeIdent
+	Iter  NodeValue
+	Body  []Node
+	Pos   Pos
+}
+
+func (n NodeFor) String() string {
+	names := string(n.Value)
+	if n.Index != "" {
+		names = fmt.Sprintf("%s, %s", n.Index, n.Value)
+	}
+	return fmt.Sprintf("for %s in %s %s", names, n.Iter, blockString(n.Body))
+}
+
+func blockString(nodes []Node) string {
+	var stmts []string
+	for _, n := range nodes {
+		stmts = append(stmts, fmt.Sprint(n))
+	}
+	return "{ " + strings.Join(stmts, "; ") + " }"
+}
+
 type NodeList[T Node] []T
 
 func (n NodeList[T]) ValueType() ValueType { return ValueList }
@@ -131,6 +380,7 @@ func (n NodeList[T]) String() string {
 type NodeCommand struct {
 	Name string
 	Args []NodeValue
+	Pos  Pos
 }
 
 func (n NodeCommand) String() string {
@@ -158,6 +408,7 @@ func (n NodePipeline) String() string {
 type NodeExpr struct {
 	Input    NodeList[NodeValue]
 	Pipeline NodePipeline
+	Pos      Pos
 }
 
 func (n NodeExpr) ValueType() ValueType { return ValueExpr }
@@ -173,6 +424,7 @@ type NodeAssign struct {
 	Dest   NodeList[NodeIdent]
 	Value  NodeValue // some simple value, expr or subexpr
 	Define bool
+	Pos    Pos
 }
 
 func (n NodeAssign) String() string {
@@ -185,31 +437,10 @@ func (n NodeAssign) String() string {
 	return fmt.Sprintf("%s = %s", destStr, valueStr)
 }
 
-// Helper function to pretty print the entire AST
+// PrettyPrintNode formats a node on one line, as its kind and its source
+// like text
 func PrettyPrintNode(n Node, indent string) string {
-	switch node := n.(type) {
-	case NodeAssign:
-		operator := "="
-		if node.Define {
-			operator = ":="
-		}
-		return fmt.Sprintf("%sAssign: %s %s %s", indent, node.Dest.String(), operator, node.Value.String())
-
-	case NodeExpr:
-		return fmt.Sprintf("%sExpr: %s", indent, node.String())
-
-	case NodeList[NodeValue], NodeList[NodeIdent]:
-		if stringer, ok := any(node).(fmt.Stringer); ok {
-			return fmt.Sprintf("%sList: %s", indent, stringer.String())
-		}
-		return fmt.Sprintf("%sList: %v", indent, node)
-
-	case NodeCommand:
-		return fmt.Sprintf("%sCommand: %s", indent, node.String())
-
-	default:
-		return fmt.Sprintf("%s%T: %v", indent, node, node)
-	}
+	return fmt.Sprintf("%s%s: %v", indent, nodeName(n), n)
 }
 
 // Enhanced version of PrintNode that provides better formatting
@@ -217,42 +448,8 @@ func PrintNode(n Node) {
 	fmt.Println(PrettyPrintNode(n, ""))
 }
 
-// Recursive pretty printer for debug purposes
+// Recursive pretty printer for debug purposes, every node of the tree is
+// printed by PrettyPrintNode
 func PrintNodeTree(n Node, indent string) {
-	fmt.Println(PrettyPrintNode(n, indent))
-
-	// Recursively print children if they exist
-	switch node := n.(type) {
-	case NodeAssign:
-		fmt.Println(indent + "  Dest:")
-		PrintNodeTree(node.Dest, indent+"    ")
-		fmt.Println(indent + "  Value:")
-		PrintNodeTree(node.Value, indent+"    ")
-
-	case NodeExpr:
-		fmt.Println(indent + "  Input:")
-		PrintNodeTree(node.Input, indent+"    ")
-		fmt.Println(indent + "  Pipeline:")
-		for i, cmd := range node.Pipeline {
-			fmt.Printf("%s  Command[%d]:\n", indent, i)
-			PrintNodeTree(cmd, indent+"    ")
-		}
-
-	case NodeList[NodeValue]:
-		for i, item := range node {
-			fmt.Printf("%s  Item[%d]:\n", indent, i)
-			PrintNodeTree(item, indent+"    ")
-		}
-
-	case NodeList[NodeIdent]:
-		for i, item := range node {
-			fmt.Printf("%s  Ident[%d]: %s\n", indent, i, item.String())
-		}
-
-	case NodeSubExpr:
-		fmt.Println(indent + "  Params:")
-		PrintNodeTree(node.Params, indent+"    ")
-		fmt.Println(indent + "  Body:")
-		PrintNodeTree(node.Body, indent+"    ")
-	}
+	printTree(n, indent, func(n Node) string { return PrettyPrintNode(n, "") })
 }
@@ -15,8 +15,10 @@ func main() {
 
 	var fileName string
 	var useStdin bool
+	var format string
 	flag.StringVar(&fileName, "script", "", "script file to parse")
 	flag.BoolVar(&useStdin, "stdin", false, "read script from stdin")
+	flag.StringVar(&format, "format", "text", "output format: text or json")
 
 	flag.Parse()
 
@@ -25,6 +27,10 @@ func main() {
 		os.Exit(1)
 	}
 
+	if format != "text" && format != "json" {
+		log.Fatalf("Unknown output format: %s", format)
+	}
+
 	var script string
 	var err error
 
@@ -38,6 +44,21 @@ func main() {
 		}
 	}
 
+	if format == "json" {
+		p := parser.Parse(script, false)
+		nodes := make([]parser.Node, 0)
+		for expr := range p.Expressions {
+			if astErr, ok := expr.(parser.AstError); ok {
+				log.Fatalf("Failed to parse script: %v", astErr)
+			}
+			nodes = append(nodes, expr)
+		}
+		if err := parser.EncodeJSON(os.Stdout, nodes); err != nil {
+			log.Fatalf("Failed to encode ast: %s", err)
+		}
+		return
+	}
+
 	p := parser.Parse(script, true)
 	for expr := range p.Expressions {
 		parser.PrintTree(expr, "")
@@ -2,14 +2,17 @@ package parser
 
 import (
 	"fmt"
+
+	"github.com/andyp1xe1/vidlang/language/commands"
 )
 
 type item struct {
 	typ itemType
 	val string
 
-	pos  int
-	line int
+	pos  int // byte offset in the input
+	line int // 0-based line
+	col  int // 1-based column
 }
 
 func (i item) String() string {
@@ -46,50 +49,60 @@ const (
 	itemMult
 	itemPlus
 
+	// comparison operators
+	itemEq
+	itemGreater
+	itemGreaterEq
+	itemLess
+	itemLessEq
+	itemNotEq
+
+	// boolean operators
+	itemAnd
+	itemNot
+	itemOr
+
 	// stream operators
 	itemAssign
 	itemDeclare
 	itemPipe
 
 	// list operators
-	itemConcatOp
+	itemRange
 
 	// literals
 	itemNumber
 	itemString
-	itemBool // TODO
+	itemBool
 
 	// delimiters
 	itemComma
 	itemLeftBrace
+	itemLeftCurly
 	itemLeftParen
 	itemNewline
 	itemRightBrace
+	itemRightCurly
 	itemRightParen
 
+	// keywords
+	itemAs
+	itemElse
+	itemFor
+	itemIf
+	itemImport
+	itemIn
+	itemThen
+
+	// builtin functions, see the commands package
+	itemFunction
+
 	// comment
 	itemComment
 
 	// commands
-	itemCommand // to delimit commands
-	itemBrigtness
-	itemConcat
-	itemContrast
-	itemCrossfade
-	itemCut
-	itemExport
-	itemFade
-	itemHue
-	itemMap
-	itemOpen
-	itemPitch
-	itemSaturation
-	itemSpeed
-	itemTrackLine
-	itemVolume
-	itemGamma
-	itemFlip
-	itemStack
+	itemCommand     // to delimit commands
+	itemCommandName // any registered command, see the commands package
 )
 
 func (i itemType) String() string {
@@ -106,12 +119,11 @@ func (i itemType) String() string {
 		return "comment"
 	case itemNewline:
 		return "newline"
+	case itemCommandName:
+		return "command"
+	case itemFunction:
+		return "function"
 	default:
-		for k, v := range commands {
-			if v == i {
-				return k
-			}
-		}
 		for k, v := range runeKeywords {
 			if v == i {
 				return string(k)
@@ -122,6 +134,11 @@ func (i itemType) String() string {
 				return k
 			}
 		}
+		for k, v := range keywords {
+			if v == i {
+				return k
+			}
+		}
 		return "unknown"
 	}
 }
@@ -135,6 +152,8 @@ var runeKeywords = map[rune]itemType{
 	',':  itemComma,
 	'[':  itemLeftBrace,
 	']':  itemRightBrace,
+	'{':  itemLeftCurly,
+	'}':  itemRightCurly,
 	'\n': itemNewline,
 
 	'_': itemUnderscore,
@@ -144,21 +163,32 @@ var runeKeywords = map[rune]itemType{
 	'-': itemMinus,
 	'/': itemDiv,
 	'=': itemAssign,
-}
-
-var mathSymbols = map[string]itemType{
-	"*": itemMult,
-	"+": itemPlus,
-	"-": itemMinus,
-	"/": itemDiv,
-	"(": itemLeftParen,
-	")": itemRightParen,
+	'<': itemLess,
+	'>': itemGreater,
 }
 
 var strOperators = map[string]itemType{
 	":=": itemDeclare,
 	"|>": itemPipe,
-	"..": itemConcatOp,
+	"..": itemRange,
+	"==": itemEq,
+	"!=": itemNotEq,
+	"<=": itemLessEq,
+	">=": itemGreaterEq,
+}
+
+// keywords are reserved words, they can't be used as identifiers
+var keywords = map[string]itemType{
+	"if":     itemIf,
+	"else":   itemElse,
+	"then":   itemThen,
+	"for":    itemFor,
+	"in":     itemIn,
+	"import": itemImport,
+	"as":     itemAs,
+	"and":    itemAnd,
+	"or":     itemOr,
+	"not":    itemNot,
 }
 
 func isStrOperator(s string) bool {
@@ -166,35 +196,12 @@ func isStrOperator(s string) bool {
 	return ok
 }
 
-var commands = map[string]itemType{
-	"volume": itemVolume, // [ ]
-
-
-	"concat": itemConcat, //  [x]
-	"cut":    itemCut,    // [x]
-
-	"saturation": itemSaturation, // x
-	"contrast":   itemContrast,   // X
-	"export":     itemExport,     // x
-	"open":       itemOpen,       // x
-	"brightness": itemBrigtness,  // x
-	"gamma": itemGamma, 					// X
-	"hue":       itemHue,         // X
-	"flip": itemFlip, 					  // X
-	"stack": itemStack,           // X
-
-	"fade":      itemFade,
-	"crossfade": itemCrossfade,
-	"pitch":     itemPitch,
-	"speed":     itemSpeed,
-
-	"trackline": itemTrackLine, // --
-	"map":       itemMap,       // --
+func isCommand(s string) bool {
+	return commands.IsCommand(s)
 }
 
-func isCommand(s string) bool {
-	_, ok := commands[s]
-	return ok
+func isFunction(s string) bool {
+	return commands.IsFunction(s)
 }
 
 const eof = -1
@@ -0,0 +1,694 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/andyp1xe1/vidlang/language/commands"
+)
+
+// JSONVersion is the version of the AST encoding written by EncodeJSON.
+// It is bumped whenever the shape of an existing node type changes.
+const JSONVersion = 1
+
+// Node type tags used in the JSON encoding.
+const (
+	jsonAssign  = "assign"
+	jsonExpr    = "expr"
+	jsonCommand = "command"
+	jsonCall    = "call"
+	jsonIndex   = "index"
+	jsonSubExpr = "subexpr"
+	jsonMath    = "math"
+	jsonUnary   = "unary"
+	jsonCond    = "cond"
+	jsonIf      = "if"
+	jsonFor     = "for"
+	jsonImport  = "import"
+	jsonNamed   = "named"
+	jsonInterp  = "interp"
+	jsonList    = "list"
+	jsonIdent   = "ident"
+	jsonSelf    = "selfstar"
+	jsonNumber  = "number"
+	jsonString  = "string"
+	jsonBool    = "bool"
+)
+
+type jsonProgram struct {
+	Version int         `json:"version"`
+	Nodes   []*jsonNode `json:"nodes"`
+}
+
+type jsonPos struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	Offset int `json:"offset"`
+}
+
+// jsonNode is the wire form of every node type, only the fields relevant
+// to Type are set.
+type jsonNode struct {
+	Type string   `json:"type"`
+	Pos  *jsonPos `json:"pos,omitempty"`
+
+	Value any    `json:"value,omitempty"`
+	Name  string `json:"name,omitempty"`
+	Op    string `json:"op,omitempty"`
+
+	Define bool     `json:"define,omitempty"`
+	Dest   []string `json:"dest,omitempty"`
+	Params []string `json:"params,omitempty"`
+
+	Rhs   *jsonNode   `json:"rhs,omitempty"`
+	Left  *jsonNode   `json:"left,omitempty"`
+	Right *jsonNode   `json:"right,omitempty"`
+	Body  *jsonNode   `json:"body,omitempty"`
+	Items []*jsonNode `json:"items,omitempty"`
+	Input []*jsonNode `json:"input,omitempty"`
+	Args  []*jsonNode `json:"args,omitempty"`
+
+	Pipeline []*jsonNode `json:"pipeline,omitempty"`
+
+	Cond *jsonNode   `json:"cond,omitempty"`
+	Then []*jsonNode `json:"then,omitempty"`
+	Else []*jsonNode `json:"else,omitempty"`
+
+	Block []*jsonNode `json:"block,omitempty"`
+}
+
+// EncodeJSON writes the given top level nodes as a versioned JSON document.
+func EncodeJSON(w io.Writer, nodes []Node) error {
+	prog := jsonProgram{Version: JSONVersion, Nodes: make([]*jsonNode, 0, len(nodes))}
+	for _, n := range nodes {
+		jn, err := toJSONNode(n)
+		if err != nil {
+			return err
+		}
+		prog.Nodes = append(prog.Nodes, jn)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(prog)
+}
+
+// DecodeJSON reads a document written by EncodeJSON and reconstructs the
+// top level nodes in order.
+func DecodeJSON(r io.Reader) ([]Node, error) {
+	var prog jsonProgram
+	if err := json.NewDecoder(r).Decode(&prog); err != nil {
+		return nil, fmt.Errorf("invalid ast json: %w", err)
+	}
+	if prog.Version != JSONVersion {
+		return nil, fmt.Errorf("unsupported ast json version %d, expected %d", prog.Version, JSONVersion)
+	}
+	nodes := make([]Node, 0, len(prog.Nodes))
+	for i, jn := range prog.Nodes {
+		n, err := fromJSONNode(jn)
+		if err != nil {
+			return nil, fmt.Errorf("node %d: %w", i, err)
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes, nil
+}
+
+// MarshalNode returns the JSON encoding of a single node.
+func MarshalNode(n Node) ([]byte, error) {
+	jn, err := toJSONNode(n)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jn)
+}
+
+// UnmarshalNode reconstructs a single node from its JSON encoding.
+func UnmarshalNode(data []byte) (Node, error) {
+	var jn jsonNode
+	if err := json.Unmarshal(data, &jn); err != nil {
+		return nil, fmt.Errorf("invalid ast json: %w", err)
+	}
+	return fromJSONNode(&jn)
+}
+
+func toJSONPos(p Pos) *jsonPos {
+	return &jsonPos{Line: p.Line, Column: p.Column, Offset: p.Offset}
+}
+
+func fromJSONPos(p *jsonPos) Pos {
+	if p == nil {
+		return Pos{}
+	}
+	return Pos{Line: p.Line, Column: p.Column, Offset: p.Offset}
+}
+
+func identsToStrings(idents NodeList[NodeIdent]) []string {
+	res := make([]string, 0, len(idents))
+	for _, id := range idents {
+		res = append(res, string(id))
+	}
+	return res
+}
+
+func stringsToIdents(names []string) NodeList[NodeIdent] {
+	if names == nil {
+		return nil
+	}
+	res := make(NodeList[NodeIdent], 0, len(names))
+	for _, name := range names {
+		res = append(res, NodeIdent(name))
+	}
+	return res
+}
+
+func toJSONValues(values []NodeValue) ([]*jsonNode, error) {
+	if values == nil {
+		return nil, nil
+	}
+	res := make([]*jsonNode, 0, len(values))
+	for _, v := range values {
+		jn, err := toJSONNode(v)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, jn)
+	}
+	return res, nil
+}
+
+func toJSONNodes(nodes []Node) ([]*jsonNode, error) {
+	if nodes == nil {
+		return nil, nil
+	}
+	res := make([]*jsonNode, 0, len(nodes))
+	for _, n := range nodes {
+		jn, err := toJSONNode(n)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, jn)
+	}
+	return res, nil
+}
+
+func toJSONNode(n Node) (*jsonNode, error) {
+	switch node := n.(type) {
+	case NodeAssign:
+		value, err := toJSONNode(node.Value)
+		if err != nil {
+			return nil, err
+		}
+		return &jsonNode{
+			Type:   jsonAssign,
+			Pos:    toJSONPos(node.Pos),
+			Define: node.Define,
+			Dest:   identsToStrings(node.Dest),
+			Rhs:    value,
+		}, nil
+
+	case NodeExpr:
+		input, err := toJSONValues(node.Input)
+		if err != nil {
+			return nil, err
+		}
+		pipeline := make([]*jsonNode, 0, len(node.Pipeline))
+		for _, cmd := range node.Pipeline {
+			jc, err := toJSONNode(cmd)
+			if err != nil {
+				return nil, err
+			}
+			pipeline = append(pipeline, jc)
+		}
+		return &jsonNode{
+			Type:     jsonExpr,
+			Pos:      toJSONPos(node.Pos),
+			Input:    input,
+			Pipeline: pipeline,
+		}, nil
+
+	case NodeCommand:
+		args, err := toJSONValues(node.Args)
+		if err != nil {
+			return nil, err
+		}
+		return &jsonNode{Type: jsonCommand, Pos: toJSONPos(node.Pos), Name: node.Name, Args: args}, nil
+
+	case NodeCall:
+		args, err := toJSONValues(node.Args)
+		if err != nil {
+			return nil, err
+		}
+		return &jsonNode{Type: jsonCall, Pos: toJSONPos(node.Pos), Name: node.Name, Args: args}, nil
+
+	case NodeIndex:
+		target, err := toJSONNode(node.Target)
+		if err != nil {
+			return nil, err
+		}
+		index, err := toJSONNode(node.Index)
+		if err != nil {
+			return nil, err
+		}
+		return &jsonNode{Type: jsonIndex, Pos: toJSONPos(node.Pos), Left: target, Right: index}, nil
+
+	case NodeSubExpr:
+		jn := &jsonNode{Type: jsonSubExpr, Pos: toJSONPos(node.Pos), Params: identsToStrings(node.Params)}
+		if node.Body != nil {
+			body, err := toJSONNode(node.Body)
+			if err != nil {
+				return nil, err
+			}
+			jn.Body = body
+		}
+		return jn, nil
+
+	case NodeNamedArg:
+		value, err := toJSONNode(node.Value)
+		if err != nil {
+			return nil, err
+		}
+		return &jsonNode{Type: jsonNamed, Pos: toJSONPos(node.Pos), Name: node.Name, Rhs: value}, nil
+
+	case NodeExprMath:
+		left, err := toJSONNode(node.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := toJSONNode(node.Right)
+		if err != nil {
+			return nil, err
+		}
+		return &jsonNode{Type: jsonMath, Pos: toJSONPos(node.Pos), Op: node.Op.String(), Left: left, Right: right}, nil
+
+	case NodeUnary:
+		operand, err := toJSONNode(node.Operand)
+		if err != nil {
+			return nil, err
+		}
+		return &jsonNode{Type: jsonUnary, Pos: toJSONPos(node.Pos), Op: node.Op.String(), Rhs: operand}, nil
+
+	case NodeCond:
+		cond, err := toJSONNode(node.Cond)
+		if err != nil {
+			return nil, err
+		}
+		branches, err := toJSONValues([]NodeValue{node.Then, node.Else})
+		if err != nil {
+			return nil, err
+		}
+		return &jsonNode{Type: jsonCond, Pos: toJSONPos(node.Pos), Cond: cond, Then: branches[:1], Else: branches[1:]}, nil
+
+	case NodeIf:
+		cond, err := toJSONNode(node.Cond)
+		if err != nil {
+			return nil, err
+		}
+		then, err := toJSONNodes(node.Then)
+		if err != nil {
+			return nil, err
+		}
+		els, err := toJSONNodes(node.Else)
+		if err != nil {
+			return nil, err
+		}
+		return &jsonNode{Type: jsonIf, Pos: toJSONPos(node.Pos), Cond: cond, Then: then, Else: els}, nil
+
+	case NodeImport:
+		return &jsonNode{Type: jsonImport, Pos: toJSONPos(node.Pos), Value: node.Path, Name: string(node.Alias)}, nil
+
+	case NodeFor:
+		iter, err := toJSONNode(node.Iter)
+		if err != nil {
+			return nil, err
+		}
+		body, err := toJSONNodes(node.Body)
+		if err != nil {
+			return nil, err
+		}
+		names := []string{string(node.Value)}
+		if node.Index != "" {
+			names = []string{string(node.Index), string(node.Value)}
+		}
+		return &jsonNode{Type: jsonFor, Pos: toJSONPos(node.Pos), Params: names, Rhs: iter, Block: body}, nil
+
+	case NodeList[NodeValue]:
+		items, err := toJSONValues(node)
+		if err != nil {
+			return nil, err
+		}
+		if items == nil {
+			items = []*jsonNode{}
+		}
+		return &jsonNode{Type: jsonList, Items: items}, nil
+
+	case NodeList[NodeIdent]:
+		items := make([]*jsonNode, 0, len(node))
+		for _, id := range node {
+			items = append(items, &jsonNode{Type: jsonIdent, Value: string(id)})
+		}
+		return &jsonNode{Type: jsonList, Items: items}, nil
+
+	case NodeIdent:
+		return &jsonNode{Type: jsonIdent, Value: string(node)}, nil
+	case NodeVar:
+		return &jsonNode{Type: jsonIdent, Pos: toJSONPos(node.Pos), Value: string(node.Name)}, nil
+	case NodeSelfStar:
+		return &jsonNode{Type: jsonSelf}, nil
+	case NodeLiteralNumber:
+		return &jsonNode{Type: jsonNumber, Value: float64(node)}, nil
+	case NodeLiteralString:
+		return &jsonNode{Type: jsonString, Value: string(node)}, nil
+	case NodeInterpolation:
+		parts, err := toJSONValues(node.Parts)
+		if err != nil {
+			return nil, err
+		}
+		return &jsonNode{Type: jsonInterp, Items: parts}, nil
+	case NodeLiteralBool:
+		return &jsonNode{Type: jsonBool, Value: bool(node)}, nil
+	}
+	return nil, fmt.Errorf("cannot encode node of type %T", n)
+}
+
+func fromJSONValue(jn *jsonNode) (NodeValue, error) {
+	n, err := fromJSONNode(jn)
+	if err != nil {
+		return nil, err
+	}
+	v, ok := n.(NodeValue)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a value node", jn.Type)
+	}
+	return v, nil
+}
+
+func fromJSONValues(nodes []*jsonNode) (NodeList[NodeValue], error) {
+	if nodes == nil {
+		return nil, nil
+	}
+	res := make(NodeList[NodeValue], 0, len(nodes))
+	for _, jn := range nodes {
+		v, err := fromJSONValue(jn)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, v)
+	}
+	return res, nil
+}
+
+func fromJSONNodes(nodes []*jsonNode) ([]Node, error) {
+	if nodes == nil {
+		return nil, nil
+	}
+	res := make([]Node, 0, len(nodes))
+	for _, jn := range nodes {
+		n, err := fromJSONNode(jn)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, n)
+	}
+	return res, nil
+}
+
+var jsonOps = map[string]OpType{
+	OpAdd.String(): OpAdd,
+	OpSub.String(): OpSub,
+	OpMul.String(): OpMul,
+	OpDiv.String(): OpDiv,
+
+	OpEq.String():        OpEq,
+	OpNotEq.String():     OpNotEq,
+	OpLess.String():      OpLess,
+	OpLessEq.String():    OpLessEq,
+	OpGreater.String():   OpGreater,
+	OpGreaterEq.String(): OpGreaterEq,
+
+	OpAnd.String(): OpAnd,
+	OpOr.String():  OpOr,
+
+	OpRange.String(): OpRange,
+}
+
+func fromJSONNode(jn *jsonNode) (Node, error) {
+	if jn == nil {
+		return nil, fmt.Errorf("missing node")
+	}
+
+	switch jn.Type {
+	case jsonAssign:
+		if len(jn.Dest) == 0 {
+			return nil, fmt.Errorf("assign without destination")
+		}
+		value, err := fromJSONValue(jn.Rhs)
+		if err != nil {
+			return nil, fmt.Errorf("assign value: %w", err)
+		}
+		return NodeAssign{
+			Dest:   stringsToIdents(jn.Dest),
+			Value:  value,
+			Define: jn.Define,
+			Pos:    fromJSONPos(jn.Pos),
+		}, nil
+
+	case jsonExpr:
+		input, err := fromJSONValues(jn.Input)
+		if err != nil {
+			return nil, fmt.Errorf("expr input: %w", err)
+		}
+		if len(jn.Pipeline) == 0 {
+			return nil, fmt.Errorf("expr without pipeline")
+		}
+		pipeline := make(NodePipeline, 0, len(jn.Pipeline))
+		for _, jc := range jn.Pipeline {
+			c, err := fromJSONNode(jc)
+			if err != nil {
+				return nil, err
+			}
+			cmd, ok := c.(NodeCommand)
+			if !ok {
+				return nil, fmt.Errorf("pipeline element %q is not a command", jc.Type)
+			}
+			pipeline = append(pipeline, cmd)
+		}
+		return NodeExpr{Input: input, Pipeline: pipeline, Pos: fromJSONPos(jn.Pos)}, nil
+
+	case jsonCommand:
+		if !isCommand(jn.Name) {
+			return nil, fmt.Errorf("unknown command %q", jn.Name)
+		}
+		args, err := fromJSONValues(jn.Args)
+		if err != nil {
+			return nil, fmt.Errorf("command %s: %w", jn.Name, err)
+		}
+		if args == nil {
+			args = make([]NodeValue, 0)
+		}
+		return NodeCommand{Name: jn.Name, Args: args, Pos: fromJSONPos(jn.Pos)}, nil
+
+	case jsonCall:
+		fn, ok := commands.LookupFunction(jn.Name)
+		if !ok {
+			return nil, fmt.Errorf("unknown function %q", jn.Name)
+		}
+		args, err := fromJSONValues(jn.Args)
+		if err != nil {
+			return nil, fmt.Errorf("function %s: %w", jn.Name, err)
+		}
+		if args == nil {
+			args = make([]NodeValue, 0)
+		}
+		if len(args) != len(fn.Params) {
+			return nil, fmt.Errorf("function %s takes %d arguments, got %d", jn.Name, len(fn.Params), len(args))
+		}
+		return NodeCall{Name: jn.Name, Args: args, Pos: fromJSONPos(jn.Pos)}, nil
+
+	case jsonIndex:
+		target, err := fromJSONValue(jn.Left)
+		if err != nil {
+			return nil, fmt.Errorf("index target: %w", err)
+		}
+		index, err := fromJSONValue(jn.Right)
+		if err != nil {
+			return nil, fmt.Errorf("index: %w", err)
+		}
+		return NodeIndex{Target: target, Index: index, Pos: fromJSONPos(jn.Pos)}, nil
+
+	case jsonSubExpr:
+		n := NodeSubExpr{Params: stringsToIdents(jn.Params), Pos: fromJSONPos(jn.Pos)}
+		if n.Params == nil {
+			n.Params = make(NodeList[NodeIdent], 0)
+		}
+		if jn.Body != nil {
+			body, err := fromJSONValue(jn.Body)
+			if err != nil {
+				return nil, fmt.Errorf("subexpr body: %w", err)
+			}
+			n.Body = body
+		}
+		return n, nil
+
+	case jsonNamed:
+		if jn.Name == "" {
+			return nil, fmt.Errorf("named argument without a name")
+		}
+		value, err := fromJSONValue(jn.Rhs)
+		if err != nil {
+			return nil, fmt.Errorf("named argument %s: %w", jn.Name, err)
+		}
+		return NodeNamedArg{Name: jn.Name, Value: value, Pos: fromJSONPos(jn.Pos)}, nil
+
+	case jsonMath:
+		op, ok := jsonOps[jn.Op]
+		if !ok {
+			return nil, fmt.Errorf("unknown math operator %q", jn.Op)
+		}
+		left, err := fromJSONValue(jn.Left)
+		if err != nil {
+			return nil, fmt.Errorf("math left operand: %w", err)
+		}
+		right, err := fromJSONValue(jn.Right)
+		if err != nil {
+			return nil, fmt.Errorf("math right operand: %w", err)
+		}
+		return NodeExprMath{Left: left, Op: op, Right: right, Pos: fromJSONPos(jn.Pos)}, nil
+
+	case jsonUnary:
+		if jn.Op != OpNot.String() {
+			return nil, fmt.Errorf("unknown unary operator %q", jn.Op)
+		}
+		operand, err := fromJSONValue(jn.Rhs)
+		if err != nil {
+			return nil, fmt.Errorf("unary operand: %w", err)
+		}
+		return NodeUnary{Op: OpNot, Operand: operand, Pos: fromJSONPos(jn.Pos)}, nil
+
+	case jsonCond:
+		cond, err := fromJSONValue(jn.Cond)
+		if err != nil {
+			return nil, fmt.Errorf("inline if condition: %w", err)
+		}
+		if len(jn.Then) != 1 || len(jn.Else) != 1 {
+			return nil, fmt.Errorf("inline if requires exactly one then and one else value")
+		}
+		then, err := fromJSONValue(jn.Then[0])
+		if err != nil {
+			return nil, fmt.Errorf("inline if then: %w", err)
+		}
+		els, err := fromJSONValue(jn.Else[0])
+		if err != nil {
+			return nil, fmt.Errorf("inline if else: %w", err)
+		}
+		return NodeCond{Cond: cond, Then: then, Else: els, Pos: fromJSONPos(jn.Pos)}, nil
+
+	case jsonIf:
+		cond, err := fromJSONValue(jn.Cond)
+		if err != nil {
+			return nil, fmt.Errorf("if condition: %w", err)
+		}
+		then, err := fromJSONNodes(jn.Then)
+		if err != nil {
+			return nil, fmt.Errorf("if body: %w", err)
+		}
+		if then == nil {
+			then = make([]Node, 0)
+		}
+		els, err := fromJSONNodes(jn.Else)
+		if err != nil {
+			return nil, fmt.Errorf("else body: %w", err)
+		}
+		return NodeIf{Cond: cond, Then: then, Else: els, Pos: fromJSONPos(jn.Pos)}, nil
+
+	case jsonImport:
+		path, ok := jn.Value.(string)
+		if !ok || path == "" {
+			return nil, fmt.Errorf("import requires a non empty string path")
+		}
+		if jn.Name == "" {
+			return nil, fmt.Errorf("import %q without a namespace", path)
+		}
+		return NodeImport{Path: path, Alias: NodeIdent(jn.Name), Pos: fromJSONPos(jn.Pos)}, nil
+
+	case jsonFor:
+		var n NodeFor
+		switch len(jn.Params) {
+		case 1:
+			n.Value = NodeIdent(jn.Params[0])
+		case 2:
+			n.Index, n.Value = NodeIdent(jn.Params[0]), NodeIdent(jn.Params[1])
+		default:
+			return nil, fmt.Errorf("for loop requires one or two names, got %d", len(jn.Params))
+		}
+		iter, err := fromJSONValue(jn.Rhs)
+		if err != nil {
+			return nil, fmt.Errorf("for loop range: %w", err)
+		}
+		body, err := fromJSONNodes(jn.Block)
+		if err != nil {
+			return nil, fmt.Errorf("for loop body: %w", err)
+		}
+		if body == nil {
+			body = make([]Node, 0)
+		}
+		n.Iter, n.Body, n.Pos = iter, body, fromJSONPos(jn.Pos)
+		return n, nil
+
+	case jsonList:
+		items, err := fromJSONValues(jn.Items)
+		if err != nil {
+			return nil, err
+		}
+		if items == nil {
+			items = make(NodeList[NodeValue], 0)
+		}
+		return items, nil
+
+	case jsonIdent:
+		name, ok := jn.Value.(string)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("ident requires a non empty string value")
+		}
+		if jn.Pos != nil {
+			return NodeVar{Name: NodeIdent(name), Pos: fromJSONPos(jn.Pos)}, nil
+		}
+		return NodeIdent(name), nil
+	case jsonSelf:
+		return NodeSelfStar{self: selfStar}, nil
+	case jsonNumber:
+		num, ok := jn.Value.(float64)
+		if !ok && jn.Value != nil {
+			return nil, fmt.Errorf("number requires a numeric value")
+		}
+		return NodeLiteralNumber(num), nil
+	case jsonString:
+		str, ok := jn.Value.(string)
+		if !ok && jn.Value != nil {
+			return nil, fmt.Errorf("string requires a string value")
+		}
+		return NodeLiteralString(str), nil
+	case jsonInterp:
+		parts, err := fromJSONValues(jn.Items)
+		if err != nil {
+			return nil, fmt.Errorf("interpolated string: %w", err)
+		}
+		for i, part := range parts {
+			switch part := part.(type) {
+			case NodeLiteralString, NodeIdent:
+			case NodeVar:
+				parts[i] = part.Name
+			default:
+				return nil, fmt.Errorf("interpolated string can only hold strings and identifiers, got %s", part)
+			}
+		}
+		return NodeInterpolation{Parts: parts}, nil
+	case jsonBool:
+		b, ok := jn.Value.(bool)
+		if !ok && jn.Value != nil {
+			return nil, fmt.Errorf("bool requires a boolean value")
+		}
+		return NodeLiteralBool(b), nil
+	}
+	return nil, fmt.Errorf("unknown node type %q", jn.Type)
+}
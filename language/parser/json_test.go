@@ -0,0 +1,114 @@
+package parser
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// parseAll parses a script and returns its top level nodes
+func parseAll(t *testing.T, script string) []Node {
+	t.Helper()
+	nodes := make([]Node, 0)
+	for n := range Parse(script, false).Expressions {
+		if err, ok := n.(AstError); ok {
+			t.Fatalf("parse %q: %v", script, err)
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
+
+func roundTrip(t *testing.T, nodes []Node) []Node {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := EncodeJSON(&buf, nodes); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	decoded, err := DecodeJSON(&buf)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return decoded
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+	}{
+		{"assign", `x := 1` + "\n" + `x = 2`},
+		{"pipeline", `clip := open "a.mp4" |> cut 0 1:30 |> brightness -0.1`},
+		{"input", `graded := clip |> contrast 1.2`},
+		{"named", `scaled := clip |> scale width=640 height=360 mode="fit"`},
+		{"list", `clips := [a, b, "c", 1, true]`},
+		{"math", `n := (1 + 2) * 3 - 4 / 5`},
+		{"logical", `ok := not a == b and c or false`},
+		{"range", `r := 0..10`},
+		{"call", `d := duration clip`},
+		{"index", `first := clips[-1]`},
+		{"cond", `out := if d > 10 then clip |> cut 0 10 else clip`},
+		{"interpolation", `name := "take_${n}.mp4"`},
+		{"qualified", `x := grade.strength`},
+		{"if", "if a > 1 {\n\tx := 1\n} else if a < 0 {\n\tx := 2\n} else {\n\tx := 3\n}"},
+		{"for", "for i, c in clips {\n\texport c \"out${i}.mp4\"\n}"},
+		{"import", `import "lib/grade.vl" as g`},
+		{"directive", `canvas 1920 1080 fps=30`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes := parseAll(t, tt.script)
+			got := roundTrip(t, nodes)
+			if !reflect.DeepEqual(got, nodes) {
+				t.Errorf("round trip of %q\n got %#v\nwant %#v", tt.script, got, nodes)
+			}
+		})
+	}
+}
+
+// TestJSONRoundTripBuilt covers the node kinds scripts can't produce yet
+func TestJSONRoundTripBuilt(t *testing.T) {
+	tests := []struct {
+		name string
+		node Node
+	}{
+		{"selfstar", NodeAssign{
+			Dest:  NodeList[NodeIdent]{"x"},
+			Value: NodeSelfStar{self: "*"},
+		}},
+		{"subexpr", NodeAssign{
+			Dest: NodeList[NodeIdent]{"f"},
+			Value: NodeSubExpr{
+				Params: NodeList[NodeIdent]{"a", "b"},
+				Body:   NodeExprMath{Left: NodeIdent("a"), Op: OpAdd, Right: NodeIdent("b")},
+				Pos:    Pos{Line: 1, Column: 6, Offset: 5},
+			},
+			Define: true,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := roundTrip(t, []Node{tt.node})
+			if len(got) != 1 || !reflect.DeepEqual(got[0], tt.node) {
+				t.Errorf("round trip\n got %#v\nwant %#v", got, tt.node)
+			}
+		})
+	}
+}
+
+func TestDecodeJSONErrors(t *testing.T) {
+	tests := []struct{ name, doc, want string }{
+		{"syntax", `{`, "invalid ast json"},
+		{"version", `{"version": 99, "nodes": []}`, "unsupported ast json version"},
+		{"type", `{"version": 1, "nodes": [{"type": "nope"}]}`, "node 0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeJSON(strings.NewReader(tt.doc))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("DecodeJSON(%s) error %v, want it to contain %q", tt.doc, err, tt.want)
+			}
+		})
+	}
+}
@@ -39,21 +39,35 @@ func run(l *lexer) {
 }
 
 func (l *lexer) emit(t itemType) {
-	l.items <- item{t, l.input[l.start:l.pos], l.start, l.startLine}
+	l.items <- item{t, l.input[l.start:l.pos], l.start, l.startLine, l.column()}
 	l.start = l.pos
 	l.startLine = l.line
+
+	switch t {
+	case itemIdentifier, itemStream, itemNumber, itemString, itemBool, itemRightBrace:
+		// `*` after a value is a multiplication
+		l.allowSelfStar = false
+	case itemComma:
+		l.allowSelfStar = true
+	}
 }
 
 // errorf returns an error token and terminates the scan by passing
 // back a nil pointer that will be the next state, terminating l.nextItem.
 func (l *lexer) errorf(format string, args ...any) stateFn {
-	l.items <- item{itemError, fmt.Sprintf(format, args...), l.start, l.startLine}
+	l.items <- item{itemError, fmt.Sprintf(format, args...), l.start, l.startLine, l.column()}
 	l.start = 0
 	l.pos = 0
 	l.input = l.input[:0]
 	return nil
 }
 
+// column returns the 1-based column, in runes, of the pending item
+func (l *lexer) column() int {
+	lineStart := strings.LastIndexByte(l.input[:l.start], '\n') + 1
+	return utf8.RuneCountInString(l.input[lineStart:l.start]) + 1
+}
+
 // accept consumes the next rune if it's from the valid set.
 func (l *lexer) accept(valid string) bool {
 	if strings.ContainsRune(valid, l.next()) {
@@ -132,7 +146,7 @@ func lexScript(l *lexer) stateFn {
 		return lexComment
 	case r == '"':
 		return lexString
-	case unicode.IsDigit(r), r == '+', r == '-':
+	case unicode.IsDigit(r), (r == '+' || r == '-') && l.isSign():
 		l.backup()
 		return lexNumber
 	case isAlphaNumeric(r):
@@ -140,35 +154,29 @@ func lexScript(l *lexer) stateFn {
 		return lexIdentifier
 	}
 
-	if op, ok := runeKeywords[r]; ok {
-		if op == itemMult && l.allowSelfStar {
-			op = itemSelfStar
-		}
-		if op == itemAssign || op == itemLeftBrace {
+	if op, ok := strOperators[string(r)+string(l.peek())]; ok {
+		l.next()
+		l.emit(op)
+		if op == itemDeclare {
 			l.allowSelfStar = true
 		}
-		if op == itemRightParen {
+		if op == itemPipe {
 			l.allowSelfStar = false
 		}
-		l.emit(op)
 		return lexScript
 	}
 
-	w := string(r)
-	p := l.next()
-	if p == eof {
-		l.emit(itemEOF)
-		return nil
-	}
-	w += string(p)
-	if op, ok := strOperators[w]; ok {
-		l.emit(op)
-		if op == itemDeclare {
+	if op, ok := runeKeywords[r]; ok {
+		if op == itemMult && l.allowSelfStar {
+			op = itemSelfStar
+		}
+		if op == itemAssign || op == itemLeftBrace {
 			l.allowSelfStar = true
 		}
-		if op == itemPipe {
+		if op == itemRightParen {
 			l.allowSelfStar = false
 		}
+		l.emit(op)
 		return lexScript
 	}
 
@@ -195,24 +203,36 @@ func lexComment(l *lexer) stateFn {
 }
 
 func lexIdentifier(l *lexer) stateFn {
+	// a dot followed by a letter continues the word, for names qualified
+	// by the namespace of an import such as grade.warm
 	var r rune
-	for r = l.next(); isAlphaNumeric(r); {
+	for r = l.next(); isAlphaNumeric(r) || r == '.' && unicode.IsLetter(l.peek()); {
 		r = l.next()
 	}
 	l.backup()
 
 	word := l.input[l.start:l.pos]
 
-	if item, ok := commands[word]; ok {
-		l.emit(item)
+	if isCommand(word) {
+		l.emit(itemCommandName)
+		return lexScript
+	}
+	if isFunction(word) {
+		l.emit(itemFunction)
 		return lexScript
 	}
 
 	switch word {
 	case globalStream:
 		l.emit(itemStream)
+	case "true", "false":
+		l.emit(itemBool)
 	default:
-		l.emit(itemIdentifier)
+		if typ, ok := keywords[word]; ok {
+			l.emit(typ)
+		} else {
+			l.emit(itemIdentifier)
+		}
 	}
 	if r == eof {
 		l.emit(itemEOF)
@@ -221,7 +241,7 @@ func lexIdentifier(l *lexer) stateFn {
 	return lexScript
 }
 
-// lexNumber scans a number: decimal, float
+// lexNumber scans a number: decimal, float or a timecode such as 1:30 or 1:02:03.5
 func lexNumber(l *lexer) stateFn {
 	// Optional leading sign
 	l.accept("+-")
@@ -229,8 +249,15 @@ func lexNumber(l *lexer) stateFn {
 	digits := "0123456789"
 	l.acceptRun(digits)
 
-	// Decimal point?
-	if l.accept(".") {
+	// Timecode segments, a colon must be followed by digits
+	for strings.HasPrefix(l.input[l.pos:], ":") && l.pos+1 < len(l.input) && unicode.IsDigit(rune(l.input[l.pos+1])) {
+		l.next()
+		l.acceptRun(digits)
+	}
+
+	// Decimal point? It must be followed by a digit, so 0..10 is a range
+	if strings.HasPrefix(l.input[l.pos:], ".") && l.pos+1 < len(l.input) && unicode.IsDigit(rune(l.input[l.pos+1])) {
+		l.next()
 		l.acceptRun(digits)
 	}
 
@@ -246,11 +273,11 @@ func lexString(l *lexer) stateFn {
 			return l.errorf("unterminated string")
 		}
 		if r == '\\' {
-			// Handle escape sequence
-			r = l.next()
-			if r == eof {
+			// Handle escape sequence, decoding is left to the parser
+			if l.next() == eof {
 				return l.errorf("unterminated string escape")
 			}
+			r = l.next()
 			continue
 		}
 		r = l.next()
@@ -259,6 +286,37 @@ func lexString(l *lexer) stateFn {
 	return lexScript
 }
 
+// isSign reports whether the `+` or `-` just read starts a signed number
+// rather than being an operator: it must be followed by a digit and must
+// not directly follow a value, so `3 -1` is two numbers but `3-1` and
+// `3 - 1` are subtractions.
+func (l *lexer) isSign() bool {
+	if !unicode.IsDigit(l.peek()) {
+		return false
+	}
+	if l.start == 0 {
+		return true
+	}
+	prev, _ := utf8.DecodeLastRuneInString(l.input[:l.start])
+	return !isAlphaNumeric(prev) && prev != ')' && prev != ']' && prev != '"'
+}
+
+// isName reports whether s is a whole word lexIdentifier reads: a letter
+// followed by letters and digits, maybe qualified by dots such as grade.warm
+func isName(s string) bool {
+	for _, part := range strings.Split(s, ".") {
+		if part == "" || !unicode.IsLetter([]rune(part)[0]) {
+			return false
+		}
+		for _, r := range part {
+			if !isAlphaNumeric(r) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 func isAlphaNumeric(r rune) bool {
 	return unicode.IsLetter(r) || unicode.IsDigit(r)
 }
@@ -3,13 +3,18 @@ package parser
 import (
 	"fmt"
 	"log"
+	"path/filepath"
 	"strconv"
+	"strings"
+
+	"github.com/andyp1xe1/vidlang/language/commands"
 )
 
 type Parser struct {
 	Expressions chan Node
 
 	lex       *lexer
+	prevItem  item
 	currItem  item
 	peekItem  item
 	peek2Item item
@@ -39,18 +44,29 @@ func (p *Parser) nextItem() {
 	if p.currItem.typ == itemError {
 		panic(NewAstError(
 			"lexical error: "+p.currItem.val,
-			p.currItem.line, p.currItem.pos))
+			p.currItem.line+1, p.currItem.col))
 	}
+	p.prevItem = p.currItem
 	p.currItem = p.peekItem
 	p.peekItem = p.peek2Item
 	p.peek2Item = <-p.lex.items
 
 }
 
+// pos returns the source position of the current item.
+func (p *Parser) pos() Pos {
+	return Pos{Line: p.currItem.line + 1, Column: p.currItem.col, Offset: p.currItem.pos}
+}
+
 func (p *Parser) errorf(format string, args ...any) {
+	p.errorAt(p.currItem, format, args...)
+}
+
+// errorAt is errorf reporting the position of an earlier item
+func (p *Parser) errorAt(it item, format string, args ...any) {
 	panic(NewAstError(
 		fmt.Sprintf("syntax error: "+format, args...),
-		p.currItem.line, p.currItem.pos))
+		it.line+1, it.col))
 }
 
 func (p *Parser) run() {
@@ -59,39 +75,249 @@ func (p *Parser) run() {
 			switch val := r.(type) {
 			case AstError:
 				p.Expressions <- val
+				close(p.Expressions)
 			default:
 				log.Fatal(val)
 			}
 		}
 	}()
 
-	for i := 0; ; i++ {
-		p.nextItem()
-		switch p.currItem.typ {
-		case itemEOF:
+	for ; ; p.nextItem() {
+		if p.currItem.typ == itemEOF {
 			close(p.Expressions)
 			return
-		case itemIdentifier:
-			switch p.peekItem.typ {
-			case itemAssign, itemDeclare, itemComma:
-				p.Expressions <- p.parseAssignment()
-			case itemPipe:
-				p.Expressions <- p.parseAssignable()
-			}
-		case itemLeftBrace, itemNumber, itemString, itemBool:
-			p.Expressions <- p.parseAssignable()
-		default:
-			if p.currItem.typ > itemCommand {
-				p.Expressions <- p.parseAssignable()
-			} else {
-				// idk
-			}
 		}
+		if n := p.parseStatement(); n != nil {
+			p.Expressions <- n
+		}
+	}
+}
+
+// parseStatement parses the statement at currItem and leaves currItem at
+// its last item. Blank lines and comments give a nil node.
+func (p *Parser) parseStatement() Node {
+	switch p.currItem.typ {
+	case itemIdentifier, itemStream:
+		switch p.peekItem.typ {
+		case itemAssign, itemDeclare, itemComma:
+			return p.parseAssignment()
+		case itemPipe, itemLeftBrace:
+			return p.parseAssignable()
+		}
+	case itemIf:
+		return p.parseIf()
+	case itemFor:
+		return p.parseFor()
+	case itemImport:
+		return p.parseImport()
+	case itemLeftBrace, itemNumber, itemString, itemBool:
+		return p.parseLiteralStatement()
+	case itemElse:
+		p.errorf("else without if, it has to follow the closing } of the if on the same line")
+	case itemRightCurly:
+		p.errorf("unexpected }")
+	default:
+		if p.currItem.typ > itemCommand {
+			return p.parseAssignable()
+		}
+	}
+	return nil
+}
+
+// parseLiteralStatement parses a statement starting with a literal, which
+// has to be piped into a command. A signed number right after a value on
+// the same line is most likely a subtraction missing its spaces, as in
+// `y := x -1`.
+func (p *Parser) parseLiteralStatement() Node {
+	start, prev := p.currItem, p.prevItem
+	n := p.parseAssignable()
+	if _, ok := n.(NodeExpr); ok {
+		return n
+	}
+	sign := start.val[0]
+	afterValue := start.typ == itemNumber && (sign == '-' || sign == '+') &&
+		prev.line == start.line && prev.typ != itemNewline
+	switch {
+	case afterValue && (prev.typ == itemIdentifier || prev.typ == itemNumber):
+		p.errorAt(start, "unexpected %s; did you mean %s %c %s?", start.val, prev.val, sign, start.val[1:])
+	case afterValue && (prev.typ == itemRightParen || prev.typ == itemRightBrace):
+		p.errorAt(start, "unexpected %s; did you mean %c %s, with a space?", start.val, sign, start.val[1:])
+	}
+	p.errorAt(start, "unexpected %s, a value on its own is not a statement", start.val)
+	return nil
+}
+
+// parseBlock parses the statements between curly braces, currItem is left
+// at the closing brace
+func (p *Parser) parseBlock() []Node {
+	assert(p.currItem.typ == itemLeftCurly,
+		"parseBlock should be invoked with currItem at left curly brace, got %s", p.currItem)
+
+	nodes := make([]Node, 0)
+	for p.nextItem(); p.currItem.typ != itemRightCurly; p.nextItem() {
+		if p.currItem.typ == itemEOF {
+			p.errorf("unterminated block, expected }")
+		}
+		if n := p.parseStatement(); n != nil {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// parseIf parses `if cond { ... }` with an optional `else { ... }` or
+// `else if ...` on the line of the closing brace
+func (p *Parser) parseIf() NodeIf {
+	var node NodeIf
+	node.Pos = p.pos()
+
+	p.nextItem()
+	node.Cond = p.parseExpression()
+
+	p.expectPeek(itemLeftCurly, "after if condition")
+	node.Then = p.parseBlock()
+
+	if p.peekItem.typ != itemElse {
+		return node
+	}
+	p.nextItem()
+
+	if p.peekItem.typ == itemIf {
+		p.nextItem()
+		node.Else = []Node{p.parseIf()}
+		return node
+	}
+	p.expectPeek(itemLeftCurly, "after else")
+	node.Else = p.parseBlock()
+	return node
+}
+
+// parseImport parses `import "path"` with an optional `as name`
+func (p *Parser) parseImport() NodeImport {
+	var node NodeImport
+	node.Pos = p.pos()
+
+	p.expectPeek(itemString, "after import")
+	path, err := decodeString(p.currItem.val)
+	if err != nil {
+		p.errorf("%v", err)
+	}
+	lit, ok := path.(NodeLiteralString)
+	if !ok || lit == "" {
+		p.errorf("import path must be a plain non empty string, got %s", path)
+	}
+	node.Path = string(lit)
+
+	if p.peekItem.typ != itemAs {
+		alias, ok := importAlias(node.Path)
+		if !ok {
+			p.errorf("can't name the namespace of %s after the file, add `as name`", path)
+		}
+		node.Alias = alias
+		return node
+	}
+	p.nextItem()
+	p.expectPeek(itemIdentifier, "after as")
+	if strings.Contains(p.currItem.val, ".") {
+		p.errorf("namespace %s can't be qualified", p.currItem.val)
+	}
+	node.Alias = NodeIdent(p.currItem.val)
+	return node
+}
+
+// importAlias derives the namespace of an import from the file name,
+// "lib/grade.vl" gives grade
+func importAlias(path string) (NodeIdent, bool) {
+	name := filepath.Base(path)
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	if !IsIdentifier(name) {
+		return "", false
+	}
+	return NodeIdent(name), true
+}
+
+// IsIdentifier reports whether s can name a variable: a letter followed by
+// letters and digits, not qualified, and not a keyword, command or function
+func IsIdentifier(s string) bool {
+	if !isName(s) || strings.Contains(s, ".") {
+		return false
+	}
+	if _, ok := keywords[s]; ok || isCommand(s) || isFunction(s) {
+		return false
+	}
+	return s != globalStream && s != "true" && s != "false"
+}
+
+// parseFor parses `for v in iter { ... }` and `for i, v in iter { ... }`
+func (p *Parser) parseFor() NodeFor {
+	var node NodeFor
+	node.Pos = p.pos()
+
+	p.expectPeek(itemIdentifier, "after for")
+	node.Value = NodeIdent(p.currItem.val)
+	if p.peekItem.typ == itemComma {
+		p.nextItem()
+		p.expectPeek(itemIdentifier, "after comma in for")
+		node.Index = node.Value
+		node.Value = NodeIdent(p.currItem.val)
+	}
+
+	p.expectPeek(itemIn, "in for loop")
+	p.nextItem()
+	node.Iter = p.parseExpression()
+
+	p.expectPeek(itemLeftCurly, "after for loop range")
+	node.Body = p.parseBlock()
+	return node
+}
+
+// parseCond parses the inline conditional `if cond then a else b`, each
+// branch being a value or a pipeline
+func (p *Parser) parseCond() NodeCond {
+	var node NodeCond
+	node.Pos = p.pos()
+
+	p.nextItem()
+	node.Cond = p.parseExpression()
+
+	p.expectPeek(itemThen, "after inline if condition")
+	p.nextItem()
+	node.Then = p.parseBranch()
+
+	p.expectPeek(itemElse, "in inline if")
+	p.nextItem()
+	node.Else = p.parseBranch()
+	return node
+}
+
+func (p *Parser) parseBranch() NodeValue {
+	if !validValues[p.currItem.typ] && p.currItem.typ < itemCommand {
+		p.errorf("expected a value or a command, got %s", p.currItem)
+	}
+	return p.parseAssignable()
+}
+
+// expectPeek moves to the next item, failing unless it has the given type
+func (p *Parser) expectPeek(typ itemType, context string) {
+	p.nextItem()
+	if p.currItem.typ != typ {
+		p.errorf("expected %s %s, got %s", typ, context, p.describeItem())
 	}
 }
 
+// describeItem names the current item for error messages
+func (p *Parser) describeItem() string {
+	if p.currItem.typ == itemNewline {
+		return "end of line"
+	}
+	return p.currItem.String()
+}
+
 var validArgs = map[itemType]bool{
 	itemLeftBrace:  true,
+	itemLeftParen:  true,
+	itemIf:         true,
+	itemFunction:   true,
 	itemIdentifier: true,
 	itemStream:     true,
 	itemNumber:     true,
@@ -102,24 +328,60 @@ var validArgs = map[itemType]bool{
 func (p *Parser) parseCommand() NodeCommand {
 	var node NodeCommand
 	node.Name = p.currItem.val
+	node.Pos = p.pos()
 	node.Args = make([]NodeValue, 0)
-	for validArgs[p.peekItem.typ] && p.peekItem.typ != itemNewline && p.currItem.typ != itemNewline {
+	for (validArgs[p.peekItem.typ] || p.commandNameArgAhead()) && p.peekItem.typ != itemNewline && p.currItem.typ != itemNewline {
 		p.nextItem()
 		assert(
-			validArgs[p.currItem.typ],
+			validArgs[p.currItem.typ] || p.currItem.typ > itemCommand,
 			"parseCommand's loop should be entered with a valid arg, but got %s",
 			p.currItem)
 		assert(
 			p.currItem.typ != itemNewline,
 			"parseCommand's loop should not process newlines",
 		)
+		// parameters may share the name of a function or a command, as in
+		// scale width=640 or text text="hi"
+		isName := p.currItem.typ == itemIdentifier || p.currItem.typ == itemStream ||
+			p.currItem.typ == itemFunction || p.currItem.typ > itemCommand
+		if isName && p.peekItem.typ == itemAssign {
+			node.Args = append(node.Args, p.parseNamedArg())
+			continue
+		}
 		node.Args = append(node.Args, p.parseValue())
 	}
 	return node
 }
 
+// commandNameArgAhead reports whether the next argument is a named
+// argument whose name is also a command
+func (p *Parser) commandNameArgAhead() bool {
+	return p.peekItem.typ > itemCommand && p.peek2Item.typ == itemAssign
+}
+
+// parseNamedArg parses a `name=value` command argument,
+// currItem is at the name
+func (p *Parser) parseNamedArg() NodeNamedArg {
+	var node NodeNamedArg
+	node.Name = p.currItem.val
+	node.Pos = p.pos()
+	p.nextItem()
+	p.nextItem()
+	if !validValues[p.currItem.typ] {
+		p.errorf("expected a value for argument %s, got %s", node.Name, p.currItem)
+	}
+	node.Value = p.parseValue()
+	return node
+}
+
 var validValues = map[itemType]bool{
 	itemLeftBrace:  true,
+	itemLeftParen:  true,
+	itemIf:         true,
+	itemNot:        true,
+	itemMinus:      true,
+	itemPlus:       true,
+	itemFunction:   true,
 	itemIdentifier: true,
 	itemNumber:     true,
 	itemString:     true,
@@ -128,10 +390,8 @@ var validValues = map[itemType]bool{
 	itemStream:     true,
 }
 
-// if it's a list, parse it
-// else if it's a value,
-// if it is a number and peek is an operation, parse math expression
-// else parse the simple value
+// parseValue parses an expression, which may be a single simple value,
+// a list or a subexpression
 // if a subexpression continues, parse it and give it the parameter list
 // if a pipeline continues, parse it, adding the list or value as input
 // return the value
@@ -141,22 +401,7 @@ func (p *Parser) parseValue() NodeValue {
 		"parseValue should be invoked with currItem at a simple value, list or subexpression got %s",
 		p.currItem)
 
-	var n NodeValue
-
-	if p.currItem.typ == itemLeftBrace {
-		n = p.parseSimpleValueList()
-		assert(
-			p.currItem.typ == itemRightBrace, "assumed that the list was terminated successfully by a right brace, but got %s -> %s", p.currItem, p.peekItem)
-		if p.peekItem.typ == itemLeftParen {
-			n = p.parseSubExpr(n)
-		}
-	} else if (p.currItem.typ == itemNumber || p.currItem.typ == itemLeftParen) && p.peekItem.typ == mathSymbols[p.peekItem.val] {
-		n = p.parseMathExpression()
-	} else {
-		n = p.parseSimpleValue()
-	}
-
-	return n
+	return p.parseExpression()
 }
 
 // TODO maybe split valeus and expressions logic
@@ -166,6 +411,7 @@ func (p *Parser) parseAssignable() NodeValue {
 		p.currItem)
 
 	var n NodeValue
+	pos := p.pos()
 
 	if validValues[p.currItem.typ] {
 		n = p.parseValue()
@@ -180,13 +426,16 @@ func (p *Parser) parseAssignable() NodeValue {
 
 		if p.currItem.typ == itemPipe {
 			p.nextItem()
+			if p.currItem.typ < itemCommand {
+				p.errorf("expected command after pipe, got %s", p.currItem)
+			}
 			if n.ValueType() != ValueList {
 				n = NodeList[NodeValue]{n}
 			}
-			n = NodeExpr{Input: n.(NodeList[NodeValue]), Pipeline: p.parsePipeline()}
+			n = NodeExpr{Input: n.(NodeList[NodeValue]), Pipeline: p.parsePipeline(), Pos: pos}
 		}
 	} else if p.currItem.typ > itemCommand {
-		n = NodeExpr{Pipeline: p.parsePipeline(), Input: nil}
+		n = NodeExpr{Pipeline: p.parsePipeline(), Input: nil, Pos: pos}
 	}
 
 	return n
@@ -199,7 +448,6 @@ func (p *Parser) parseSubExprBody() NodeValue {
 	p.nextItem()
 
 	if p.currItem.typ == itemRightParen {
-		p.nextItem()
 		return nil
 	}
 
@@ -211,12 +459,11 @@ func (p *Parser) parseSubExprBody() NodeValue {
 	if p.currItem.typ != itemRightParen {
 		p.errorf("expected right paren at the end of subexpression body, got %s -> %s", p.currItem, p.peekItem)
 	}
-	p.nextItem()
 
 	return n
 }
 
-func (p *Parser) parseSubExpr(v NodeValue) NodeSubExpr {
+func (p *Parser) parseSubExpr(v NodeValue, pos Pos) NodeSubExpr {
 
 	assert(v.ValueType() == ValueList,
 		"parseSubExpr's argument is assumed to be a list, but got %s", p.currItem)
@@ -226,11 +473,13 @@ func (p *Parser) parseSubExpr(v NodeValue) NodeSubExpr {
 		if arg.ValueType() != ValueIdentifier {
 			p.errorf("a subexpression's argument list must be a list of identifiers, but got %s", arg)
 		}
-		argList = append(argList, arg.(NodeIdent))
+		name, _ := VarName(arg)
+		argList = append(argList, name)
 	}
 
 	var n NodeSubExpr
 	n.Params = argList
+	n.Pos = pos
 
 	p.nextItem()
 	n.Body = p.parseSubExprBody()
@@ -299,7 +548,7 @@ func (p *Parser) parseSimpleValue() NodeValue {
 	var n NodeValue
 	switch p.currItem.typ {
 	case itemIdentifier, itemSelfStar, itemStream:
-		n = NodeIdent(p.currItem.val)
+		n = NodeVar{Name: NodeIdent(p.currItem.val), Pos: p.pos()}
 	case itemNumber:
 		n = NodeLiteralNumber(strToLiteralNumber(p.currItem.val))
 		if p.debug {
@@ -309,7 +558,11 @@ func (p *Parser) parseSimpleValue() NodeValue {
 	case itemBool:
 		n = NodeLiteralBool(strToLiteralBool(p.currItem.val))
 	case itemString:
-		n = NodeLiteralString(p.currItem.val)
+		v, err := decodeString(p.currItem.val)
+		if err != nil {
+			p.errorf("%v", err)
+		}
+		n = v
 	default:
 		p.errorf("parseSimpleValue should be invoked with a valid value, but got %s", p.currItem)
 	}
@@ -317,15 +570,70 @@ func (p *Parser) parseSimpleValue() NodeValue {
 	return n
 }
 
+// ParseLiteral reads a value given outside of a script, such as a command
+// line parameter, with its type inferred from the syntax: true and false
+// are bools, numbers and timecodes are numbers, a quoted string is decoded
+// and anything else is taken as a plain string
+func ParseLiteral(s string) (NodeValue, error) {
+	switch {
+	case s == "true" || s == "false":
+		return strToLiteralBool(s), nil
+	case isNumberLiteral(s):
+		return strToLiteralNumber(s), nil
+	case strings.HasPrefix(s, `"`):
+		v, err := decodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := v.(NodeInterpolation); ok {
+			return nil, fmt.Errorf("interpolation is not allowed in %s", s)
+		}
+		return v, nil
+	}
+	return NodeLiteralString(s), nil
+}
+
+// isNumberLiteral reports whether the lexer would read all of s as a
+// single number
+func isNumberLiteral(s string) bool {
+	// like a script line, the input ends with a newline
+	l := lex(s + "\n")
+	first, second := <-l.items, <-l.items
+	for range l.items {
+	}
+	return first.typ == itemNumber && first.val == s && second.typ == itemNewline
+}
+
 func strToLiteralBool(s string) NodeLiteralBool { return s == "true" }
 func strToLiteralNumber(s string) NodeLiteralNumber {
+	if strings.Contains(s, ":") {
+		return timecodeToLiteralNumber(s)
+	}
 	n, err := strconv.ParseFloat(s, 64)
 	assert(err == nil, "lexer mus provided a valid number, failed to parse number %s", s)
 	return NodeLiteralNumber(n)
 }
 
+// timecodeToLiteralNumber converts [-]h:m:s or m:s into seconds
+func timecodeToLiteralNumber(s string) NodeLiteralNumber {
+	sign := 1.0
+	if strings.HasPrefix(s, "-") {
+		sign = -1
+	}
+	s = strings.TrimLeft(s, "+-")
+
+	var total float64
+	for _, part := range strings.Split(s, ":") {
+		n, err := strconv.ParseFloat(part, 64)
+		assert(err == nil, "lexer mus provided a valid timecode, failed to parse %s", s)
+		total = total*60 + n
+	}
+	return NodeLiteralNumber(sign * total)
+}
+
 func (p *Parser) parseAssignment() NodeAssign {
 	var node NodeAssign
+	node.Pos = p.pos()
 
 	node.Dest = p.parseIdentList()
 
@@ -362,26 +670,40 @@ func (p *Parser) parseIdentList() NodeList[NodeIdent] {
 }
 
 var precedences = map[itemType]int{
-	itemPlus:  1,
-	itemMinus: 1,
-	itemMult:  2,
-	itemDiv:   2,
+	itemOr:        1,
+	itemAnd:       2,
+	itemEq:        3,
+	itemNotEq:     3,
+	itemLess:      3,
+	itemLessEq:    3,
+	itemGreater:   3,
+	itemGreaterEq: 3,
+	itemRange:     4,
+	itemPlus:      5,
+	itemMinus:     5,
+	itemMult:      6,
+	itemDiv:       6,
 	// if we add exp
-	// itemCaret: 3,
+	// itemCaret: 7,
 }
 
-func (p *Parser) parseMathExpression() NodeValue {
-	return p.parseBinary(0)
+// parseExpression parses operators by precedence climbing. Like the
+// other parse functions it leaves currItem at the last item of the
+// expression, so an operator is only consumed when it is the peekItem.
+func (p *Parser) parseExpression() NodeValue {
+	return p.parseBinary(1)
 }
 
 func (p *Parser) parseBinary(minPrec int) NodeValue {
+	pos := p.pos()
 	left := p.parseUnary()
 
 	for {
-		prec, isOp := precedences[p.currItem.typ]
+		prec, isOp := precedences[p.peekItem.typ]
 		if !isOp || prec < minPrec {
 			break
 		}
+		p.nextItem()
 		op := OpType(p.currItem.typ)
 		p.nextItem()
 
@@ -389,41 +711,90 @@ func (p *Parser) parseBinary(minPrec int) NodeValue {
 
 		right := p.parseBinary(nextMin)
 
-		left = NodeExprMath{Left: left, Op: op, Right: right}
+		left = NodeExprMath{Left: left, Op: op, Right: right, Pos: pos}
 	}
 	return left
 }
 
 func (p *Parser) parseUnary() NodeValue {
-	if p.currItem.typ == itemPlus || p.currItem.typ == itemMinus {
+	pos := p.pos()
+	switch p.currItem.typ {
+	case itemPlus, itemMinus:
 		op := OpType(p.currItem.typ)
 		p.nextItem()
 		operand := p.parseUnary()
-		return NodeExprMath{Left: NodeLiteralNumber(0), Op: op, Right: operand}
+		return NodeExprMath{Left: NodeLiteralNumber(0), Op: op, Right: operand, Pos: pos}
+	case itemNot:
+		// `not a == b` negates the comparison, `not a and b` only a
+		p.nextItem()
+		operand := p.parseBinary(precedences[itemEq])
+		return NodeUnary{Op: OpNot, Operand: operand, Pos: pos}
 	}
-	return p.parsePrimary()
+	return p.parsePostfix()
 }
 
-func (p *Parser) parsePrimary() NodeValue {
-	switch p.currItem.typ {
-	case itemIdentifier:
-		node := NodeIdent(p.currItem.val)
+// parsePostfix parses a primary followed by indexes such as args[0]. The
+// bracket has to touch the value, `concat a [b]` passes a list.
+func (p *Parser) parsePostfix() NodeValue {
+	pos := p.pos()
+	n := p.parsePrimary()
+	for p.peekItem.typ == itemLeftBrace && p.currItem.pos+len(p.currItem.val) == p.peekItem.pos {
 		p.nextItem()
-		return node
-	case itemNumber:
-		node := strToLiteralNumber(p.currItem.val)
 		p.nextItem()
-		return node
+		if !validValues[p.currItem.typ] {
+			p.errorf("expected an index, got %s", p.describeItem())
+		}
+		index := p.parseExpression()
+		p.expectPeek(itemRightBrace, "after index")
+		n = NodeIndex{Target: n, Index: index, Pos: pos}
+	}
+	return n
+}
+
+// parseCall parses a function call, the function takes exactly as many
+// arguments as it has parameters
+func (p *Parser) parseCall() NodeCall {
+	node := NodeCall{Name: p.currItem.val, Pos: p.pos()}
+	fn, ok := commands.LookupFunction(node.Name)
+	assert(ok, "lexer emitted unknown function %s", node.Name)
+
+	node.Args = make([]NodeValue, 0, len(fn.Params))
+	for _, param := range fn.Params {
+		p.nextItem()
+		if !validValues[p.currItem.typ] {
+			p.errorf("expected argument %s of %s, got %s", param.Name, node.Name, p.describeItem())
+		}
+		node.Args = append(node.Args, p.parseUnary())
+	}
+	return node
+}
+
+func (p *Parser) parsePrimary() NodeValue {
+	switch p.currItem.typ {
 	case itemLeftParen:
 		p.nextItem()
-		node := p.parseMathExpression()
-		if p.currItem.typ != itemRightParen {
-			p.errorf("missing closing parenthesis")
+		node := p.parseExpression()
+		if p.peekItem.typ != itemRightParen {
+			p.nextItem()
+			p.errorf("missing closing parenthesis, got %s", p.describeItem())
 		}
 		p.nextItem()
 		return node
+	case itemIf:
+		return p.parseCond()
+	case itemFunction:
+		return p.parseCall()
+	case itemLeftBrace:
+		pos := p.pos()
+		list := p.parseSimpleValueList()
+		if p.peekItem.typ == itemLeftParen {
+			return p.parseSubExpr(list, pos)
+		}
+		return list
+	case itemIdentifier, itemSelfStar, itemStream, itemNumber, itemString, itemBool:
+		return p.parseSimpleValue()
 	default:
-		p.errorf("unexpected token in expression %s", p.currItem)
+		p.errorf("unexpected token in expression %s", p.describeItem())
 		return nil
 	}
 }
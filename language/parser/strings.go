@@ -0,0 +1,118 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// decodeString turns a quoted string token into its value. Escape
+// sequences are decoded and `${name}` references turn the result into a
+// NodeInterpolation, a plain NodeLiteralString is returned otherwise.
+func decodeString(raw string) (NodeValue, error) {
+	if len(raw) < 2 || raw[0] != '"' || raw[len(raw)-1] != '"' {
+		return nil, fmt.Errorf("malformed string %s", raw)
+	}
+	body := raw[1 : len(raw)-1]
+
+	var parts []NodeValue
+	var sb strings.Builder
+
+	for i := 0; i < len(body); {
+		c := body[i]
+		switch {
+		case c == '\\':
+			r, n, err := decodeEscape(body[i:])
+			if err != nil {
+				return nil, err
+			}
+			sb.WriteRune(r)
+			i += n
+
+		case c == '$' && strings.HasPrefix(body[i:], "${"):
+			end := strings.IndexByte(body[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated ${ in string %s", raw)
+			}
+			name := strings.TrimSpace(body[i+2 : i+end])
+			if !isName(name) {
+				return nil, fmt.Errorf("invalid name %q in ${...}", name)
+			}
+			if sb.Len() > 0 {
+				parts = append(parts, NodeLiteralString(sb.String()))
+				sb.Reset()
+			}
+			parts = append(parts, NodeIdent(name))
+			i += end + 1
+
+		default:
+			sb.WriteByte(c)
+			i++
+		}
+	}
+
+	if parts == nil {
+		return NodeLiteralString(sb.String()), nil
+	}
+	if sb.Len() > 0 {
+		parts = append(parts, NodeLiteralString(sb.String()))
+	}
+	return NodeInterpolation{Parts: parts}, nil
+}
+
+// decodeEscape decodes the escape sequence at the start of s, returning the
+// rune and the number of bytes consumed
+func decodeEscape(s string) (rune, int, error) {
+	if len(s) < 2 {
+		return 0, 0, fmt.Errorf("unterminated string escape")
+	}
+	switch s[1] {
+	case 'n':
+		return '\n', 2, nil
+	case 't':
+		return '\t', 2, nil
+	case 'r':
+		return '\r', 2, nil
+	case '\\':
+		return '\\', 2, nil
+	case '"':
+		return '"', 2, nil
+	case '$':
+		return '$', 2, nil
+	case 'u':
+		if len(s) < 6 {
+			return 0, 0, fmt.Errorf("escape sequence %s needs 4 hex digits", s)
+		}
+		code, err := strconv.ParseUint(s[2:6], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(code)) {
+			return 0, 0, fmt.Errorf("invalid escape sequence %s", s[:6])
+		}
+		return rune(code), 6, nil
+	}
+	r, _ := utf8.DecodeRuneInString(s[1:])
+	return 0, 0, fmt.Errorf("unknown escape sequence \\%c", r)
+}
+
+// quoteString is the inverse of decodeString for plain text
+func quoteString(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\\', '"', '$':
+			sb.WriteByte('\\')
+			sb.WriteRune(r)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
@@ -0,0 +1,59 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInterpolationNames(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want []NodeValue // nil when the string is invalid
+	}{
+		{`"${name}.mp4"`, []NodeValue{NodeIdent("name"), NodeLiteralString(".mp4")}},
+		{`"${ take2 }"`, []NodeValue{NodeIdent("take2")}},
+		{`"a_${grade.name}"`, []NodeValue{NodeLiteralString("a_"), NodeIdent("grade.name")}},
+		{`"${my_var}"`, nil},
+		{`"${grade.}"`, nil},
+		{`"${2pass}"`, nil},
+		{`"${}"`, nil},
+	}
+	for _, tt := range tests {
+		got, err := decodeString(tt.raw)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("decodeString(%s) = %v, want an error", tt.raw, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("decodeString(%s): %v", tt.raw, err)
+			continue
+		}
+		interp, ok := got.(NodeInterpolation)
+		if !ok || !reflect.DeepEqual(interp.Parts, tt.want) {
+			t.Errorf("decodeString(%s) = %#v, want parts %#v", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestIsIdentifier(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"clip", true},
+		{"take2", true},
+		{"my_var", false},
+		{"grade.warm", false}, // definitions can't be qualified
+		{"2pass", false},
+		{"open", false},
+		{"if", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := IsIdentifier(tt.name); got != tt.want {
+			t.Errorf("IsIdentifier(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -1,72 +1,117 @@
 package parser
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
-func PrintTree(n interface{}, indent string) {
-	switch node := n.(type) {
+// PrintTree prints a node and its children, one per line, each indented
+// under its parent
+func PrintTree(n Node, indent string) {
+	printTree(n, indent, treeLabel)
+}
 
-	case NodeAssign:
-		fmt.Printf("%sAssignment:\n", indent)
-		fmt.Printf("%sDest:\n", indent+"  ")
-		// node.dest is a nodeList[nodeIdent]
-		for _, dest := range node.Dest {
-			PrintTree(dest, indent+"    ")
+// printTree prints the lines given by label for the nodes Inspect visits,
+// indented by their depth
+func printTree(n Node, indent string, label func(Node) string) {
+	depth := 0
+	Inspect(n, func(node Node) bool {
+		if node == nil {
+			depth--
+			return false
 		}
-		fmt.Printf("%sValue:\n", indent+"  ")
-		PrintTree(node.Value, indent+"    ")
+		fmt.Printf("%s%s\n", indent+strings.Repeat("  ", depth), label(node))
+		depth++
+		return true
+	})
+}
 
+// treeLabel describes a node without its children, which PrintTree prints
+// below it
+func treeLabel(n Node) string {
+	switch node := n.(type) {
+	case NodeAssign:
+		if node.Define {
+			return "Assignment (:=)"
+		}
+		return "Assignment (=)"
+	case NodeCommand:
+		return fmt.Sprintf("Command: %s", node.Name)
+	case NodeNamedArg:
+		return fmt.Sprintf("Named Argument: %s", node.Name)
 	case NodeExprMath:
-		fmt.Printf("%sMath Expression: (Operator: %s)\n", indent, node.Op)
-		fmt.Printf("%sLeft:\n", indent+"  ")
-		PrintTree(node.Left, indent+"    ")
-		fmt.Printf("%sRight:\n", indent+"  ")
-		PrintTree(node.Right, indent+"    ")
+		return fmt.Sprintf("Math Expression: (Operator: %s)", node.Op)
+	case NodeUnary:
+		return fmt.Sprintf("Unary Expression: (Operator: %s)", node.Op)
+	case NodeCall:
+		return fmt.Sprintf("Call: %s", node.Name)
+	case NodeIf:
+		// the condition comes first, then the statements of each branch
+		return fmt.Sprintf("If Statement: (Then: %d, Else: %d)", len(node.Then), len(node.Else))
+	case NodeFor:
+		return fmt.Sprintf("For Loop: (Body: %d)", len(node.Body))
+	case NodeImport:
+		return fmt.Sprintf("Import: %s", quoteString(node.Path))
+	case NodeList[NodeValue]:
+		return fmt.Sprintf("List (length %d)", len(node))
+	case NodeList[NodeIdent]:
+		return fmt.Sprintf("Names (length %d)", len(node))
+	case NodeLiteralString, NodeLiteralNumber, NodeLiteralBool, NodeIdent, NodeVar, NodeSelfStar, AstError:
+		return fmt.Sprintf("%v", node)
+	}
+	return nodeName(n)
+}
 
+// nodeName names the kind of a node. Like Walk, it panics on node types it
+// does not know about.
+func nodeName(n Node) string {
+	switch n.(type) {
+	case NodeAssign:
+		return "Assign"
 	case NodeExpr:
-		fmt.Printf("%sExpression:\n", indent)
-		if node.Input != nil {
-			fmt.Printf("%sInput:\n", indent+"  ")
-			PrintTree(node.Input, indent+"    ")
-		}
-		if len(node.Pipeline) > 0 {
-			fmt.Printf("%sPipeline:\n", indent+"  ")
-			for i, cmd := range node.Pipeline {
-				fmt.Printf("%sCommand %d:\n", indent+"    ", i)
-				fmt.Printf("%s  Name: %s\n", indent+"      ", cmd.Name)
-				if len(cmd.Args) > 0 {
-					fmt.Printf("%s  Args:\n", indent+"      ")
-					for _, arg := range cmd.Args {
-						PrintTree(arg, indent+"        ")
-					}
-				}
-			}
-		}
-
+		return "Expression"
+	case NodePipeline:
+		return "Pipeline"
+	case NodeCommand:
+		return "Command"
 	case NodeSubExpr:
-		fmt.Printf("%sSub-Expression:\n", indent)
-		fmt.Printf("%sParams:\n", indent+"  ")
-		for _, param := range node.Params {
-			PrintTree(param, indent+"    ")
-		}
-		fmt.Printf("%sBody:\n", indent+"  ")
-		PrintTree(node.Body, indent+"    ")
-
-	case NodeList[NodeValue]:
-		fmt.Printf("%sList (length %d):\n", indent, len(node))
-		for _, item := range node {
-			PrintTree(item, indent+"  ")
-		}
-
-	// For literal values and identifiers
-	case NodeLiteralString, NodeLiteralNumber, NodeLiteralBool, NodeIdent, NodeSelfStar:
-		fmt.Printf("%s%v\n", indent, node)
-
-	default:
-		// If the node implements nodeValue, use its String method.
-		if nv, ok := n.(NodeValue); ok {
-			fmt.Printf("%s%s\n", indent, nv.String())
-		} else {
-			fmt.Printf("%sUnknown node: %#v\n", indent, n)
-		}
+		return "Sub-Expression"
+	case NodeNamedArg:
+		return "Named Argument"
+	case NodeInterpolation:
+		return "Interpolated String"
+	case NodeExprMath:
+		return "Math Expression"
+	case NodeUnary:
+		return "Unary Expression"
+	case NodeCall:
+		return "Call"
+	case NodeIndex:
+		return "Index"
+	case NodeCond:
+		return "Conditional"
+	case NodeFor:
+		return "For Loop"
+	case NodeIf:
+		return "If Statement"
+	case NodeList[NodeValue], NodeList[NodeIdent]:
+		return "List"
+	case NodeImport:
+		return "Import"
+	case NodeIdent:
+		return "Identifier"
+	case NodeVar:
+		return "Variable"
+	case NodeSelfStar:
+		return "Self Star"
+	case NodeLiteralNumber:
+		return "Number"
+	case NodeLiteralString:
+		return "String"
+	case NodeLiteralBool:
+		return "Bool"
+	case AstError:
+		return "Error"
 	}
+	panic(fmt.Sprintf("parser: unexpected node type %T", n))
 }
@@ -0,0 +1,311 @@
+package parser
+
+import "fmt"
+
+// A Visitor's Visit method is invoked for each node encountered by Walk.
+// If the result visitor w is not nil, Walk visits each of the children
+// of node with the visitor w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses an AST in depth-first order: It starts by calling
+// v.Visit(node); node must not be nil. If the visitor w returned by
+// v.Visit(node) is not nil, Walk is invoked recursively with visitor
+// w for each of the non-nil children of node, followed by a call of
+// w.Visit(nil).
+//
+// Walk panics on node types it does not know about, so a new node kind
+// can't be skipped silently by the tools built on top of it.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case NodeAssign:
+		Walk(v, n.Dest)
+		if n.Value != nil {
+			Walk(v, n.Value)
+		}
+
+	case NodeExpr:
+		if n.Input != nil {
+			Walk(v, n.Input)
+		}
+		Walk(v, n.Pipeline)
+
+	case NodePipeline:
+		for _, cmd := range n {
+			Walk(v, cmd)
+		}
+
+	case NodeCommand:
+		for _, arg := range n.Args {
+			Walk(v, arg)
+		}
+
+	case NodeSubExpr:
+		Walk(v, n.Params)
+		if n.Body != nil {
+			Walk(v, n.Body)
+		}
+
+	case NodeNamedArg:
+		Walk(v, n.Value)
+
+	case NodeInterpolation:
+		for _, part := range n.Parts {
+			Walk(v, part)
+		}
+
+	case NodeExprMath:
+		Walk(v, n.Left)
+		Walk(v, n.Right)
+
+	case NodeUnary:
+		Walk(v, n.Operand)
+
+	case NodeCall:
+		for _, arg := range n.Args {
+			Walk(v, arg)
+		}
+
+	case NodeIndex:
+		Walk(v, n.Target)
+		Walk(v, n.Index)
+
+	case NodeCond:
+		Walk(v, n.Cond)
+		Walk(v, n.Then)
+		Walk(v, n.Else)
+
+	case NodeFor:
+		if n.Index != "" {
+			Walk(v, n.Index)
+		}
+		Walk(v, n.Value)
+		Walk(v, n.Iter)
+		for _, stmt := range n.Body {
+			Walk(v, stmt)
+		}
+
+	case NodeIf:
+		Walk(v, n.Cond)
+		for _, stmt := range n.Then {
+			Walk(v, stmt)
+		}
+		for _, stmt := range n.Else {
+			Walk(v, stmt)
+		}
+
+	case NodeList[NodeValue]:
+		for _, item := range n {
+			Walk(v, item)
+		}
+
+	case NodeList[NodeIdent]:
+		for _, item := range n {
+			Walk(v, item)
+		}
+
+	case NodeImport:
+		Walk(v, n.Alias)
+
+	case NodeIdent, NodeVar, NodeSelfStar, NodeLiteralNumber, NodeLiteralString, NodeLiteralBool, AstError:
+		// leaves
+
+	default:
+		panic(fmt.Sprintf("parser.Walk: unexpected node type %T", n))
+	}
+
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses an AST in depth-first order: It starts by calling
+// f(node); node must not be nil. If f returns true, Inspect invokes f
+// recursively for each of the non-nil children of node, followed by a
+// call of f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// Rewrite traverses an AST bottom-up and replaces every node with the
+// result of f, which is called once the children of the node have already
+// been rewritten. Returning the argument unchanged keeps the node.
+//
+// The replacement must fit the slot it goes into: values for values,
+// commands for pipeline elements and identifiers for assignment
+// destinations and parameters. Rewrite panics otherwise.
+func Rewrite(node Node, f func(Node) Node) Node {
+	switch n := node.(type) {
+	case NodeAssign:
+		n.Dest = rewriteIdents(n.Dest, f)
+		if n.Value != nil {
+			n.Value = rewriteValue(n.Value, f)
+		}
+		return f(n)
+
+	case NodeExpr:
+		if n.Input != nil {
+			n.Input = rewriteValues(n.Input, f)
+		}
+		pipeline, ok := Rewrite(n.Pipeline, f).(NodePipeline)
+		if !ok {
+			panic("parser.Rewrite: a pipeline can only be replaced by a pipeline")
+		}
+		n.Pipeline = pipeline
+		return f(n)
+
+	case NodePipeline:
+		return f(rewritePipeline(n, f))
+
+	case NodeCommand:
+		return f(rewriteCommand(n, f))
+
+	case NodeSubExpr:
+		n.Params = rewriteIdents(n.Params, f)
+		if n.Body != nil {
+			n.Body = rewriteValue(n.Body, f)
+		}
+		return f(n)
+
+	case NodeNamedArg:
+		n.Value = rewriteValue(n.Value, f)
+		return f(n)
+
+	case NodeInterpolation:
+		n.Parts = rewriteValues(n.Parts, f)
+		return f(n)
+
+	case NodeExprMath:
+		n.Left = rewriteValue(n.Left, f)
+		n.Right = rewriteValue(n.Right, f)
+		return f(n)
+
+	case NodeUnary:
+		n.Operand = rewriteValue(n.Operand, f)
+		return f(n)
+
+	case NodeCall:
+		n.Args = rewriteValues(n.Args, f)
+		return f(n)
+
+	case NodeIndex:
+		n.Target = rewriteValue(n.Target, f)
+		n.Index = rewriteValue(n.Index, f)
+		return f(n)
+
+	case NodeCond:
+		n.Cond = rewriteValue(n.Cond, f)
+		n.Then = rewriteValue(n.Then, f)
+		n.Else = rewriteValue(n.Else, f)
+		return f(n)
+
+	case NodeFor:
+		if n.Index != "" {
+			n.Index = rewriteIdent(n.Index, f)
+		}
+		n.Value = rewriteIdent(n.Value, f)
+		n.Iter = rewriteValue(n.Iter, f)
+		n.Body = rewriteNodes(n.Body, f)
+		return f(n)
+
+	case NodeIf:
+		n.Cond = rewriteValue(n.Cond, f)
+		n.Then = rewriteNodes(n.Then, f)
+		n.Else = rewriteNodes(n.Else, f)
+		return f(n)
+
+	case NodeList[NodeValue]:
+		return f(rewriteValues(n, f))
+
+	case NodeList[NodeIdent]:
+		return f(rewriteIdents(n, f))
+
+	case NodeImport:
+		n.Alias = rewriteIdent(n.Alias, f)
+		return f(n)
+
+	case NodeIdent, NodeVar, NodeSelfStar, NodeLiteralNumber, NodeLiteralString, NodeLiteralBool, AstError:
+		return f(n)
+	}
+	panic(fmt.Sprintf("parser.Rewrite: unexpected node type %T", node))
+}
+
+func rewriteValue(v NodeValue, f func(Node) Node) NodeValue {
+	res := Rewrite(v, f)
+	val, ok := res.(NodeValue)
+	if !ok {
+		panic(fmt.Sprintf("parser.Rewrite: %T can't replace value %s", res, v))
+	}
+	return val
+}
+
+func rewriteNodes(nodes []Node, f func(Node) Node) []Node {
+	if nodes == nil {
+		return nil
+	}
+	res := make([]Node, 0, len(nodes))
+	for _, n := range nodes {
+		res = append(res, Rewrite(n, f))
+	}
+	return res
+}
+
+func rewriteValues(list NodeList[NodeValue], f func(Node) Node) NodeList[NodeValue] {
+	res := make(NodeList[NodeValue], 0, len(list))
+	for _, item := range list {
+		res = append(res, rewriteValue(item, f))
+	}
+	return res
+}
+
+func rewriteIdents(list NodeList[NodeIdent], f func(Node) Node) NodeList[NodeIdent] {
+	if list == nil {
+		return nil
+	}
+	res := make(NodeList[NodeIdent], 0, len(list))
+	for _, item := range list {
+		res = append(res, rewriteIdent(item, f))
+	}
+	return res
+}
+
+func rewriteIdent(ident NodeIdent, f func(Node) Node) NodeIdent {
+	res, ok := Rewrite(ident, f).(NodeIdent)
+	if !ok {
+		panic(fmt.Sprintf("parser.Rewrite: identifier %s can only be replaced by an identifier", ident))
+	}
+	return res
+}
+
+func rewriteCommand(cmd NodeCommand, f func(Node) Node) NodeCommand {
+	args := make([]NodeValue, 0, len(cmd.Args))
+	for _, arg := range cmd.Args {
+		args = append(args, rewriteValue(arg, f))
+	}
+	cmd.Args = args
+	return cmd
+}
+
+func rewritePipeline(pipeline NodePipeline, f func(Node) Node) NodePipeline {
+	res := make(NodePipeline, 0, len(pipeline))
+	for _, cmd := range pipeline {
+		c, ok := Rewrite(cmd, f).(NodeCommand)
+		if !ok {
+			panic(fmt.Sprintf("parser.Rewrite: command %s can only be replaced by a command", cmd.Name))
+		}
+		res = append(res, c)
+	}
+	return res
+}
@@ -0,0 +1,198 @@
+package parser
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// renameIdent replaces every use of one identifier by another
+func renameIdent(from, to NodeIdent) func(Node) Node {
+	return func(n Node) Node {
+		if v, ok := n.(NodeVar); ok && v.Name == from {
+			v.Name = to
+			return v
+		}
+		if n == from {
+			return to
+		}
+		return n
+	}
+}
+
+// foldConstants replaces math on two number literals by its result
+func foldConstants(n Node) Node {
+	m, ok := n.(NodeExprMath)
+	if !ok {
+		return n
+	}
+	left, lok := m.Left.(NodeLiteralNumber)
+	right, rok := m.Right.(NodeLiteralNumber)
+	if !lok || !rok {
+		return n
+	}
+	switch m.Op {
+	case OpAdd:
+		return left + right
+	case OpSub:
+		return left - right
+	case OpMul:
+		return left * right
+	}
+	return n
+}
+
+// renameCommand replaces the name of every command called from
+func renameCommand(from, to string) func(Node) Node {
+	return func(n Node) Node {
+		if cmd, ok := n.(NodeCommand); ok && cmd.Name == from {
+			cmd.Name = to
+			return cmd
+		}
+		return n
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		f      func(Node) Node
+		want   string
+	}{
+		{"ident in assign", `y := x + 1`, renameIdent("x", "z"), "[y] := (z + 1)"},
+		{"destination", `x := 1`, renameIdent("x", "z"), "[z] := 1"},
+		{"pipeline input", `b := a |> brightness x`, renameIdent("a", "c"), "[b] := [c] |> brightness(x)"},
+		{"named arg", `b := a |> scale width=w height=h`, renameIdent("w", "h"), "[b] := [a] |> scale(width=h, height=h)"},
+		{"fold nested", `n := (1 + 2) * 3 - 4`, foldConstants, "[n] := 5"},
+		{"fold in call", `b := a |> cut 1 2 + 3`, foldConstants, "[b] := [a] |> cut(1, 5)"},
+		{"command", `b := a |> brightness 1 |> contrast 2`, renameCommand("contrast", "gamma"), "[b] := [a] |> brightness(1) |> gamma(2)"},
+		{"if", "if x > 1 {\n\ty := x\n}", renameIdent("x", "z"), "if (z > 1) { [y] := z }"},
+		{"for", "for i, c in clips {\n\texport c \"a\"\n}", renameIdent("c", "d"), `for i, d in clips { [] |> export(d, "a") }`},
+		{"cond", `y := if x then 1 + 1 else 2`, foldConstants, "[y] := if x then 2 else 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes := parseAll(t, tt.script)
+			if len(nodes) != 1 {
+				t.Fatalf("%q parsed into %d nodes, want 1", tt.script, len(nodes))
+			}
+			got := fmt.Sprint(Rewrite(nodes[0], tt.f))
+			if got != tt.want {
+				t.Errorf("Rewrite(%q) = %s, want %s", tt.script, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRewriteIdentity(t *testing.T) {
+	script := "clip := open \"a.mp4\" |> cut 0 5\nif duration clip > 2 {\n\tx := [clip, clip][0]\n}\n"
+	for _, n := range parseAll(t, script) {
+		got := Rewrite(n, func(n Node) Node { return n })
+		if !reflect.DeepEqual(got, n) {
+			t.Errorf("identity rewrite changed the node\n got %#v\nwant %#v", got, n)
+		}
+	}
+}
+
+func TestRewriteMismatchPanics(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		f      func(Node) Node
+	}{
+		{"value by command", `y := x`, func(n Node) Node {
+			if v, ok := n.(NodeVar); ok && v.Name == "x" {
+				return NodeCommand{Name: "hflip"}
+			}
+			return n
+		}},
+		{"command by value", `b := a |> flip "h"`, func(n Node) Node {
+			if _, ok := n.(NodeCommand); ok {
+				return NodeLiteralNumber(1)
+			}
+			return n
+		}},
+		{"destination by value", `x := 1`, func(n Node) Node {
+			if n == NodeIdent("x") {
+				return NodeLiteralNumber(1)
+			}
+			return n
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := parseAll(t, tt.script)[0]
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Rewrite(%q) did not panic", tt.script)
+				}
+			}()
+			Rewrite(node, tt.f)
+		})
+	}
+}
+
+func TestInspect(t *testing.T) {
+	nodes := parseAll(t, `y := a |> cut 1 (2 + x)`)
+
+	var visited []string
+	Inspect(nodes[0], func(n Node) bool {
+		if n != nil {
+			visited = append(visited, strings.TrimPrefix(fmt.Sprintf("%T", n), "parser."))
+		}
+		return true
+	})
+	want := []string{
+		"NodeAssign", "NodeList[...]", "NodeIdent", "NodeExpr", "NodeList[...]", "NodeVar",
+		"NodePipeline", "NodeCommand", "NodeLiteralNumber", "NodeExprMath", "NodeLiteralNumber", "NodeVar",
+	}
+	for i := range visited {
+		if strings.HasPrefix(visited[i], "NodeList[") {
+			visited[i] = "NodeList[...]"
+		}
+	}
+	if !reflect.DeepEqual(visited, want) {
+		t.Errorf("visited %v, want %v", visited, want)
+	}
+
+	// returning false skips the children of a node
+	idents := 0
+	Inspect(nodes[0], func(n Node) bool {
+		switch n.(type) {
+		case NodeIdent, NodeVar:
+			idents++
+		}
+		_, isMath := n.(NodeExprMath)
+		return !isMath
+	})
+	if idents != 2 {
+		t.Errorf("found %d identifiers outside of math, want 2", idents)
+	}
+}
+
+func TestPrintersKnowEveryKind(t *testing.T) {
+	script := "import \"lib/grade.vl\" as g\n" +
+		"clip := open \"a.mp4\" |> scale width=640 360 |> cut 0 (1 + x)\n" +
+		"if not ok {\n\tn := -[1, 2][0]\n} else {\n\tm := 1\n}\n" +
+		"for i, c in clips {\n\ts := \"take ${i}\"\n\td := if duration c > 2 then 1 else 2\n}\n"
+	// the parser does not read subexpressions yet
+	sub := NodeSubExpr{Params: NodeList[NodeIdent]{"a"}, Body: NodeSelfStar{self: "*"}}
+	for _, n := range append(parseAll(t, script), sub) {
+		Inspect(n, func(node Node) bool {
+			if node != nil {
+				treeLabel(node)
+				PrettyPrintNode(node, "")
+			}
+			return true
+		})
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("nodeName of an unknown node did not panic")
+		}
+	}()
+	nodeName(struct{}{})
+}
@@ -1,70 +1,87 @@
 package main
 
 import (
-	"bufio"
 	"flag"
-	"io"
 	"log"
 	"os"
 
+	"github.com/andyp1xe1/vidlang/language/commands"
 	"github.com/andyp1xe1/vidlang/language/interpreter"
+	"github.com/andyp1xe1/vidlang/language/parser"
 )
 
 func main() {
-
-	var fileName string
-	var useStdin bool
-	var debug bool
-	var nopreview bool
-	flag.StringVar(&fileName, "script", "", "script file to parse")
-	flag.BoolVar(&useStdin, "stdin", false, "read script from stdin")
-	flag.BoolVar(&debug, "debug", false, "enable debug mode")
-	flag.BoolVar(&nopreview, "nopreview", false, "enable debug mode")
+	flags := interpreter.RegisterFlags(flag.CommandLine)
+	var astFile string
+	flag.StringVar(&astFile, "ast", "", "JSON encoded AST to run instead of a script")
 
 	flag.Parse()
 
-	if len(fileName) == 0 && !useStdin {
+	opts, err := flags.Options(flag.Args())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if flag.Arg(0) == "help" && len(flags.Script) == 0 && !flags.Stdin && len(astFile) == 0 {
+		if err := printHelp(flag.Arg(1)); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if len(flags.Script) == 0 && !flags.Stdin && len(astFile) == 0 {
 		flag.Usage()
 		os.Exit(1)
 	}
 
-	var script string
-	var err error
-
-	if useStdin {
-		if script, err = readStdin(); err != nil {
-			log.Fatalf("Failed to read stdin: %s", err)
+	if len(astFile) != 0 {
+		opts.Path = astFile
+		nodes, err := readAST(astFile)
+		if err != nil {
+			log.Fatalf("Failed to read ast file: %s", err)
+		}
+		if flags.Check {
+			if err := interpreter.CheckNodes(nodes, opts); err != nil {
+				log.Fatalf("Check failed: %v", err)
+			}
+			return
 		}
-	} else {
-		if script, err = readFile(fileName); err != nil {
-			log.Fatalf("Failed to read script file: %s", err)
+		if err := interpreter.InterpretNodes(nodes, opts); err != nil {
+			log.Fatalf("Failed to interpret script: %v", err)
 		}
+		return
 	}
 
-	if err := interpreter.Interpret(script, debug, !nopreview); err != nil {
+	script, err := flags.ReadScript()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if flags.Check {
+		if err := interpreter.Check(script, opts); err != nil {
+			log.Fatalf("Check failed: %v", err)
+		}
+		return
+	}
+
+	if err := interpreter.Interpret(script, opts); err != nil {
 		log.Fatalf("Failed to interpret script: %v", err)
 	}
 }
 
-func readFile(fileName string) (string, error) {
-	res, err := os.ReadFile(fileName)
-	if err != nil {
-		return "", err
+// printHelp lists every command, or describes one when name is given
+func printHelp(name string) error {
+	if name == "" {
+		return commands.WriteHelp(os.Stdout)
 	}
-	return string(res), nil
+	return commands.WriteCommandHelp(os.Stdout, name)
 }
 
-func readStdin() (string, error) {
-	var script string
-	reader := bufio.NewReader(os.Stdin)
-	for {
-		line, err := reader.ReadString('\n')
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			return "", err
-		}
-		script += line
+func readAST(fileName string) ([]parser.Node, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
 	}
-	return script, nil
+	defer f.Close()
+	return parser.DecodeJSON(f)
 }